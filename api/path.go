@@ -3,6 +3,11 @@ package api
 const Base = "/"
 const Health = "/health"
 const Deployments = "/deployments"
+const Rollback = Deployments + "/{id}/rollback"
+const Approve = Deployments + "/{id}/approve"
+const Revisions = "/revisions"
+const Placements = "/placements"
+const Placement = Placements + "/{group}"
 
 func Url(baseUrl string, path string) string {
 	return baseUrl + Base + path
@@ -1,13 +1,17 @@
 package apiv1
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/anliksim/bsc-deployer/api"
 	"github.com/anliksim/bsc-deployer/appctl"
 	"github.com/anliksim/bsc-deployer/appctl/kubectl"
 	"github.com/anliksim/bsc-deployer/config"
+	"github.com/anliksim/bsc-deployer/history"
 	"github.com/anliksim/bsc-deployer/model"
 	modelv1 "github.com/anliksim/bsc-deployer/model/v1"
+	"github.com/anliksim/bsc-deployer/notify"
 	"github.com/anliksim/bsc-deployer/util"
 	"github.com/gorilla/mux"
 	"github.com/nvellon/hal"
@@ -16,31 +20,51 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
 	"time"
 )
 
 var baseUrl string
 
-var deployments = make(map[time.Time]string)
+var notifier *notify.Notifier
+
+const defaultSnapshotDir = "snapshots"
+
+var store *history.Store
+
+// directory ?dir= of the placements is resolved in, ?dir= is rejected if empty
+var envRoot string
 
 var running = prometheus.NewGauge(prometheus.GaugeOpts{
 	Name: "cloud_deployments",
 	Help: "Captures cloud deployment runs",
 })
 
-func Register(r *mux.Router, base string) {
+func Register(r *mux.Router, base string, deployerConfig *config.DeployerConfig) {
 	baseUrl = base
+	notifier = notify.New(deployerConfig.Notifications)
+	store = openStore(deployerConfig.History)
+	envRoot = deployerConfig.Placements.EnvRoot
 	r.HandleFunc(Path(""), getBase)
 	r.HandleFunc(Path(api.Health), getHealth)
 	r.HandleFunc(Path(api.Deployments), getDeploy).Methods("GET")
 	r.HandleFunc(Path(api.Deployments), postDeploy).Methods("POST")
 	r.HandleFunc(Path(api.Deployments), deleteDeploy).Methods("DELETE")
+	r.HandleFunc(Path(api.Rollback), postRollback).Methods("POST")
+	r.HandleFunc(Path(api.Approve), postApprove).Methods("POST")
+	r.HandleFunc(Path(api.Revisions), getRevisions).Methods("GET")
+	r.HandleFunc(Path(api.Placements), getPlacements).Methods("GET")
+	r.HandleFunc(Path(api.Placement), getPlacement).Methods("GET")
 }
 
 func getBase(w http.ResponseWriter, r *http.Request) {
 	res := hal.NewResource(&model.None{}, Url(baseUrl, ""))
 	res.AddNewLink("health", Url(baseUrl, api.Health))
 	res.AddNewLink("deployments", Url(baseUrl, api.Deployments))
+	res.AddNewLink("revisions", Url(baseUrl, api.Revisions))
+	res.AddNewLink("placements", Url(baseUrl, api.Placements))
 	util.RespondJson(w, res)
 }
 
@@ -51,10 +75,28 @@ func getHealth(w http.ResponseWriter, r *http.Request) {
 	util.RespondJson(w, res)
 }
 
+func openStore(historyConfig config.HistoryConfig) *history.Store {
+	dir := historyConfig.SnapshotDir
+	if dir == "" {
+		dir = defaultSnapshotDir
+	}
+	s, err := history.NewStore(dir, historyConfig.Keep)
+	if err != nil {
+		log.Fatalf("Error opening deployment history: %v", err)
+	}
+	return s
+}
+
 func getDeploy(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Requesting deployment status")
+	entries := store.List()
+	awaitingApproval := make(map[string]bool)
+	for _, d := range entries {
+		awaitingApproval[d.Id] = appctl.AwaitingApproval(d.Id)
+	}
 	res := hal.NewResource(&modelv1.Deployments{
-		Entries: deployments,
+		Entries:          entries,
+		AwaitingApproval: awaitingApproval,
 	}, Url(baseUrl, api.Deployments))
 	util.RespondJson(w, res)
 }
@@ -70,24 +112,104 @@ func postDeploy(w http.ResponseWriter, r *http.Request) {
 	log.Printf("%v\n", deployData)
 
 	now := time.Now()
-	deployments[now] = "apply: " + deployData.Rev
+	deployment := newDeployment(history.ActionApply, deployData.Rev, deployData.Dir, now)
+	deployment.Force = deployData.Force
+	store.Add(deployment)
 
 	// async
-	go deploy(deployData, now)
+	go deploy(deployment, deployData.CallbackUrl)
 
 	util.Respond(w, now.Format("2006-01-02 15:04:05"))
 }
 
-func deploy(data *config.DeploymentData, time time.Time) {
+func postRollback(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	log.Printf("Request for rollback to %s", id)
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Fatalf("Error reading body: %v", err)
+	}
+	rollbackData := new(config.RollbackData)
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, rollbackData); err != nil {
+			http.Error(w, fmt.Sprintf("invalid rollback request: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	target, err := store.Get(id)
+	if err == history.ErrNotFound {
+		http.Error(w, fmt.Sprintf("deployment %s not found", id), http.StatusNotFound)
+		return
+	}
+	if !target.Rollbackable() {
+		http.Error(w, fmt.Sprintf("deployment %s is %s %s without snapshot to roll back to",
+			id, target.Action, target.Status), http.StatusConflict)
+		return
+	}
+
+	now := time.Now()
+	// re-apply the snapshot, including the policies active back then
+	deployment := newDeployment(history.ActionRollback, target.Rev, target.Snapshot, now)
+	deployment.RollbackOf = target.Id
+	deployment.Force = rollbackData.Force
+	store.Add(deployment)
+
+	// async
+	go deploy(deployment, "")
+
+	w.WriteHeader(http.StatusAccepted)
+	util.Respond(w, deployment.Id)
+}
+
+func postApprove(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	log.Printf("Request for approval of %s", id)
+
+	if _, err := store.Get(id); err == history.ErrNotFound {
+		http.Error(w, fmt.Sprintf("deployment %s not found", id), http.StatusNotFound)
+		return
+	}
+	if err := appctl.Approve(id); err != nil {
+		http.Error(w, fmt.Sprintf("deployment %s: %v", id, err), http.StatusConflict)
+		return
+	}
+	util.Respond(w, id)
+}
+
+func newDeployment(action string, rev string, dir string, started time.Time) history.Deployment {
+	return history.Deployment{
+		Id:      deploymentId(started),
+		Action:  action,
+		Rev:     rev,
+		Dir:     dir,
+		Started: started,
+	}
+}
+
+func deploy(deployment history.Deployment, callbackUrl string) {
 	// set deployment timestamp
 	running.SetToCurrentTime()
+	// run from a snapshot so the exact inputs can be re-applied on rollback
+	if snapshot, err := store.Snapshot(deployment.Id); err == nil {
+		deployment.Dir = snapshot
+	} else {
+		log.Printf("Deploying without rollback snapshot: %v", err)
+	}
 	// run deployment
-	appctl.DeployAll(data.Dir)
+	req := request(deployment)
+	if lastGood, found := store.LastGood(); found {
+		lastGoodRequest := appctl.Request{Id: lastGood.Id, Dir: lastGood.Snapshot, Rev: lastGood.Rev}
+		req.LastGood = &lastGoodRequest
+	}
+	result := appctl.DeployAll(req)
+	notifyFinished(deployment, callbackUrl, result)
 	// register deployment in prometheus via pushgateway
 
-	if err := push.New(kubectl.GetPushGatewayUrl(), data.Rev).
+	if err := push.New(kubectl.GetPushGatewayUrl(), deployment.Rev).
 		Collector(running).
-		Grouping("timestamp", time.Format("2006-01-02 15:04:05")).
+		Grouping("timestamp", deployment.Started.Format("2006-01-02 15:04:05")).
 		Add(); err != nil {
 		fmt.Println("Failed to register deployment:", err)
 	}
@@ -104,10 +226,228 @@ func deleteDeploy(w http.ResponseWriter, r *http.Request) {
 	log.Printf("%v\n", deployData)
 
 	now := time.Now()
-	deployments[now] = "delete: " + deployData.Rev
+	deployment := newDeployment(history.ActionDelete, deployData.Rev, deployData.Dir, now)
+	store.Add(deployment)
 
 	// async
-	go appctl.DeleteAll(deployData.Dir)
+	go undeploy(deployment, deployData.CallbackUrl)
 
 	util.Respond(w, now.Format("2006-01-02 15:04:05"))
 }
+
+func undeploy(deployment history.Deployment, callbackUrl string) {
+	result := appctl.DeleteAll(request(deployment))
+	notifyFinished(deployment, callbackUrl, result)
+}
+
+func getRevisions(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Requesting deployed revisions")
+	res := hal.NewResource(&modelv1.Revisions{
+		Clouds: toRevisions(appctl.DeployedRevisions()),
+	}, Url(baseUrl, api.Revisions))
+	util.RespondJson(w, res)
+}
+
+func toRevisions(deployed map[string]map[string]*appctl.Revision) map[string]map[string]modelv1.Revision {
+	clouds := make(map[string]map[string]modelv1.Revision)
+	for cloud, groups := range deployed {
+		revisions := make(map[string]modelv1.Revision)
+		for group, revision := range groups {
+			revisions[group] = modelv1.Revision{
+				Rev:          revision.Rev,
+				DeploymentId: revision.DeploymentId,
+				AppliedAt:    revision.AppliedAt,
+				Objects:      revision.Objects,
+				Mixed:        revision.Mixed,
+			}
+		}
+		clouds[cloud] = revisions
+	}
+	return clouds
+}
+
+func getPlacements(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Requesting placements")
+	dir, ok := placementsDir(w, r)
+	if !ok {
+		return
+	}
+	groups, err := appctl.Placements(dir)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error evaluating placements: %v", err), http.StatusInternalServerError)
+		return
+	}
+	placements := make([]modelv1.GroupPlacement, len(groups))
+	for i, g := range groups {
+		placements[i] = toPlacement(g)
+	}
+	res := hal.NewResource(&modelv1.Placements{Groups: placements, Dir: dir}, Url(baseUrl, api.Placements))
+	util.RespondJson(w, res)
+}
+
+func getPlacement(w http.ResponseWriter, r *http.Request) {
+	group := mux.Vars(r)["group"]
+	log.Printf("Requesting placement of %s", group)
+	dir, ok := placementsDir(w, r)
+	if !ok {
+		return
+	}
+	groups, err := appctl.Placements(dir)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error evaluating placements: %v", err), http.StatusInternalServerError)
+		return
+	}
+	for _, g := range groups {
+		if g.Group == group {
+			res := hal.NewResource(&modelv1.Placement{Group: toPlacement(g)}, Url(baseUrl, api.Placements+"/"+group))
+			util.RespondJson(w, res)
+			return
+		}
+	}
+	http.Error(w, fmt.Sprintf("cloud group %s not found", group), http.StatusNotFound)
+}
+
+func toPlacement(g appctl.GroupPlacement) modelv1.GroupPlacement {
+	placement := modelv1.GroupPlacement{
+		Group:   g.Group,
+		Cpols:   g.Cpols,
+		Policy:  g.Policy,
+		Targets: g.Targets,
+		Reasons: g.Reasons,
+		Errors:  g.Errors,
+	}
+	for _, c := range g.Clouds {
+		placement.Clouds = append(placement.Clouds, modelv1.CloudSelectors{
+			Cloud:  c.Cloud,
+			Action: c.Action,
+			Apply:  c.Apply,
+			Delete: c.Delete,
+		})
+	}
+	return placement
+}
+
+// env repo to read the policies from, given as the snapshot of a deployment or
+// as dir within the env root, empty to read the cpols from the cluster
+func placementsDir(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.URL.Query().Get("deployment")
+	if id == "" {
+		dir := r.URL.Query().Get("dir")
+		if dir == "" {
+			return "", true
+		}
+		if envRoot == "" {
+			http.Error(w, "dir is not allowed, placements.envRoot is not configured", http.StatusBadRequest)
+			return "", false
+		}
+		// cleaned as absolute path first, so the result cannot leave the env root
+		return existingDir(w, filepath.Join(envRoot, filepath.Clean("/"+dir)))
+	}
+	deployment, err := store.Get(id)
+	if err == history.ErrNotFound {
+		http.Error(w, fmt.Sprintf("deployment %s not found", id), http.StatusNotFound)
+		return "", false
+	}
+	if deployment.Snapshot == "" {
+		http.Error(w, fmt.Sprintf("deployment %s has no snapshot", id), http.StatusConflict)
+		return "", false
+	}
+	return existingDir(w, deployment.Snapshot)
+}
+
+func existingDir(w http.ResponseWriter, dir string) (string, bool) {
+	info, err := os.Stat(dir)
+	switch {
+	case os.IsNotExist(err):
+		http.Error(w, fmt.Sprintf("%s not found", dir), http.StatusNotFound)
+		return "", false
+	case err != nil:
+		http.Error(w, fmt.Sprintf("error reading %s: %v", dir, err), http.StatusInternalServerError)
+		return "", false
+	case !info.IsDir():
+		http.Error(w, fmt.Sprintf("%s is not a directory", dir), http.StatusBadRequest)
+		return "", false
+	}
+	return dir, true
+}
+
+func request(deployment history.Deployment) appctl.Request {
+	return appctl.Request{Id: deployment.Id, Dir: deployment.Dir, Rev: deployment.Rev, Force: deployment.Force}
+}
+
+func notifyFinished(deployment history.Deployment, callbackUrl string, result *appctl.Result) {
+	event := notify.Event{
+		Id:       deployment.Id,
+		Action:   deployment.Action,
+		Rev:      deployment.Rev,
+		Status:   history.StatusSucceeded,
+		Started:  deployment.Started,
+		Finished: time.Now(),
+	}
+	if result.Failed() {
+		event.Status = history.StatusFailed
+		if len(result.RolledBack) > 0 {
+			event.Status = history.StatusRolledBack
+		}
+		for _, err := range result.Errors {
+			event.Errors = append(event.Errors, err.Error())
+		}
+	}
+	store.Finish(deployment.Id, history.Outcome{
+		Status:    event.Status,
+		Finished:  event.Finished,
+		Errors:    event.Errors,
+		Readiness: readiness(result),
+		Clouds:    cloudSummaries(result),
+		Decisions: result.Decisions,
+	})
+	notifier.Send(event, callbackUrl)
+}
+
+func readiness(result *appctl.Result) []history.Readiness {
+	var readiness []history.Readiness
+	for _, r := range result.Readiness {
+		readiness = append(readiness, history.Readiness{
+			Cloud:     r.Cloud,
+			Group:     r.Group,
+			Kind:      r.Kind,
+			Namespace: r.Namespace,
+			Name:      r.Name,
+			Ready:     r.Ready,
+			Error:     r.Error,
+		})
+	}
+	return readiness
+}
+
+func cloudSummaries(result *appctl.Result) []history.CloudSummary {
+	var summaries []history.CloudSummary
+	for _, c := range result.Clouds {
+		summaries = append(summaries, history.CloudSummary{
+			Cloud:    c.Cloud,
+			Deployed: c.Deployed,
+			Failed:   c.Failed,
+			Skipped:  c.Skipped,
+			Seconds:  c.Duration.Seconds(),
+		})
+	}
+	return summaries
+}
+
+// guards the last issued id, requests within the same millisecond get a suffix
+var idMutex sync.Mutex
+var lastId string
+var lastIdCount int
+
+func deploymentId(time time.Time) string {
+	idMutex.Lock()
+	defer idMutex.Unlock()
+	id := time.Format("20060102-150405.000")
+	if id != lastId {
+		lastId = id
+		lastIdCount = 0
+		return id
+	}
+	lastIdCount++
+	return fmt.Sprintf("%s-%d", id, lastIdCount)
+}
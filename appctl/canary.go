@@ -0,0 +1,209 @@
+package appctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/anliksim/bsc-deployer/appctl/kubectl"
+	"github.com/anliksim/bsc-deployer/appctl/metricsctl"
+	"github.com/anliksim/bsc-deployer/config"
+	"log"
+	"math"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// percentage of the replicas the canary of a Deployment runs with, enables canaries
+const canaryWeightAnnotation = "deployer/canary-weight"
+
+// added to the selector and pods of canaries to keep them apart from the stable pods
+const trackLabel = "deployer/track"
+const canaryTrack = "canary"
+const canarySuffix = "-canary"
+
+const defaultCanaryAnalysis = 5 * time.Minute
+const defaultCanaryInterval = 30 * time.Second
+
+// metrics analysis of canaries, disabled without metrics client
+var canary struct {
+	metrics   *metricsctl.Client
+	query     *template.Template
+	threshold float64
+	analysis  time.Duration
+	interval  time.Duration
+}
+
+// values the canary query is rendered with
+type canaryQueryData struct {
+	Name      string
+	Namespace string
+	// name of the canary deployment
+	Canary string
+}
+
+func configureCanary(canaryConfig config.CanaryConfig) {
+	canary.metrics = nil
+	if canaryConfig.PrometheusUrl == "" {
+		return
+	}
+	query, err := template.New("canary").Option("missingkey=error").Parse(canaryConfig.Query)
+	if err != nil || canaryConfig.Query == "" {
+		log.Fatalf("Invalid canary query %q: %v", canaryConfig.Query, err)
+	}
+	canary.metrics = metricsctl.NewClient(canaryConfig.PrometheusUrl, metricsctl.DefaultTimeout)
+	canary.query = query
+	canary.threshold = canaryConfig.Threshold
+	canary.analysis = defaultCanaryAnalysis
+	if canaryConfig.AnalysisSeconds > 0 {
+		canary.analysis = time.Duration(canaryConfig.AnalysisSeconds) * time.Second
+	}
+	canary.interval = defaultCanaryInterval
+	if canaryConfig.IntervalSeconds > 0 {
+		canary.interval = time.Duration(canaryConfig.IntervalSeconds) * time.Second
+	}
+}
+
+// runs a canary for each Deployment of the selected manifests with a canary weight
+// that changes the revision on the cloud, each Deployment once per deployment run,
+// returns the manifests without the Deployments whose canary was aborted
+func runCanaries(request Request, c cloud, manifests []config.Object, selector string, result *Result) []config.Object {
+	if canary.metrics == nil {
+		return manifests
+	}
+	selected, _ := config.SelectObjects(manifests, selector)
+	for _, object := range selected {
+		weight, ok := object.Annotations[canaryWeightAnnotation]
+		if object.Kind != kindDeployment || !ok {
+			continue
+		}
+		key := object.Namespace + "/" + object.Name
+		run, first := result.claimCanary(key)
+		if !first {
+			continue
+		}
+		stable, err := kubectl.GetObject(c.context, "deployment", object.Name, object.Namespace)
+		if err != nil || stable == nil || stable.Annotations[revAnnotation] == request.Rev {
+			// nothing to compare the new revision with
+			run.finish(false)
+			continue
+		}
+		log.Printf("Running canary of %s on %s...", key, c.context)
+		err = runCanary(c, object, weight)
+		if err != nil {
+			result.addError(fmt.Errorf("aborted canary of %s on %s: %v", key, c.context, err))
+		}
+		run.finish(err != nil)
+	}
+	return withoutAbortedCanaries(manifests, selected, result)
+}
+
+// deploys the canary next to the stable deployment, checks its metrics and
+// removes it again, the stable deployment is updated by the caller on success
+func runCanary(c cloud, deployment config.Object, weight string) error {
+	canaryDeployment, err := canaryOf(deployment, weight)
+	if err != nil {
+		return err
+	}
+	manifests := []config.Object{canaryDeployment}
+	defer func() {
+		_ = kubectl.DeleteWithSelector(c.context, manifests, "")
+	}()
+	changed, err := kubectl.ApplyWithSelector(c.context, manifests, "")
+	if err != nil {
+		return err
+	}
+	for _, rollout := range kubectl.WaitForRollouts(c.context, changed, rolloutTimeout) {
+		if !rollout.Ready() {
+			return rollout.Err
+		}
+	}
+	var query bytes.Buffer
+	data := canaryQueryData{Name: deployment.Name, Namespace: deployment.Namespace, Canary: canaryDeployment.Name}
+	if err := canary.query.Execute(&query, data); err != nil {
+		return err
+	}
+	return analyse(query.String(), time.Now().Add(canary.analysis))
+}
+
+// queries the metrics each interval until the deadline, fails on the first
+// value above the threshold or failed query
+func analyse(query string, deadline time.Time) error {
+	for {
+		value, err := canary.metrics.Query(query)
+		if err != nil {
+			return err
+		}
+		if value > canary.threshold {
+			return fmt.Errorf("%s is %v, above %v", query, value, canary.threshold)
+		}
+		log.Printf("%s is %v", query, value)
+		if time.Now().Add(canary.interval).After(deadline) {
+			return nil
+		}
+		time.Sleep(canary.interval)
+	}
+}
+
+// copy of the deployment named <name>-canary with weight percent of its replicas,
+// pods keep their labels so services route to them, the track label keeps the
+// replica sets of canary and stable deployment apart
+func canaryOf(deployment config.Object, weight string) (config.Object, error) {
+	percent, err := strconv.ParseFloat(weight, 64)
+	if err != nil || percent <= 0 || percent > 100 {
+		return config.Object{}, fmt.Errorf("invalid %s %q", canaryWeightAnnotation, weight)
+	}
+	var content map[string]interface{}
+	if err := json.Unmarshal(deployment.Raw, &content); err != nil {
+		return config.Object{}, err
+	}
+	metadata := mapField(content, "metadata")
+	metadata["name"] = deployment.Name + canarySuffix
+	spec := mapField(content, "spec")
+	replicas := 1.0
+	if value, ok := spec["replicas"].(float64); ok {
+		replicas = value
+	}
+	spec["replicas"] = math.Max(1, math.Ceil(replicas*percent/100))
+	mapField(mapField(spec, "selector"), "matchLabels")[trackLabel] = canaryTrack
+	mapField(mapField(mapField(spec, "template"), "metadata"), "labels")[trackLabel] = canaryTrack
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return config.Object{}, err
+	}
+	objects, err := config.DecodeObjects(raw)
+	if err != nil {
+		return config.Object{}, err
+	}
+	return objects[0], nil
+}
+
+// the nested map, created if missing
+func mapField(content map[string]interface{}, field string) map[string]interface{} {
+	value, ok := content[field].(map[string]interface{})
+	if !ok {
+		value = make(map[string]interface{})
+		content[field] = value
+	}
+	return value
+}
+
+// only the selected deployments are checked, others are not applied by the
+// caller and must not wait for canaries of other groups or clouds
+func withoutAbortedCanaries(manifests []config.Object, selected []config.Object, result *Result) []config.Object {
+	checked := make(map[string]bool)
+	for _, object := range selected {
+		if object.Kind == kindDeployment {
+			checked[object.Namespace+"/"+object.Name] = true
+		}
+	}
+	var kept []config.Object
+	for _, object := range manifests {
+		key := object.Namespace + "/" + object.Name
+		if object.Kind == kindDeployment && checked[key] && result.canaryAborted(key) {
+			continue
+		}
+		kept = append(kept, object)
+	}
+	return kept
+}
@@ -0,0 +1,100 @@
+package appctl
+
+import (
+	"github.com/anliksim/bsc-deployer/appctl/metricsctl"
+	"github.com/anliksim/bsc-deployer/config"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const canaryDeploymentYaml = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: rest-app
+  namespace: rest-ha
+  labels: {cloud-group: rest-ha}
+  annotations: {deployer/canary-weight: "20"}
+spec:
+  replicas: 6
+  selector:
+    matchLabels: {app: rest}
+  template:
+    metadata:
+      labels: {app: rest}
+`
+
+func TestCanaryOf(t *testing.T) {
+	deployment := decodeObjects(t, canaryDeploymentYaml)[0]
+
+	canaryDeployment, err := canaryOf(deployment, "20")
+	assert.NoError(t, err)
+	assert.Equal(t, "rest-app-canary", canaryDeployment.Name)
+	assert.Equal(t, "rest-ha", canaryDeployment.Labels["cloud-group"])
+	d, err := config.JsonToDeployment(canaryDeployment.Raw)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), *d.Spec.Replicas)
+	assert.Equal(t, map[string]string{"app": "rest", trackLabel: canaryTrack}, d.Spec.Selector.MatchLabels)
+	assert.Equal(t, map[string]string{"app": "rest", trackLabel: canaryTrack}, d.Spec.Template.Labels)
+}
+
+func TestCanaryOf_InvalidWeight(t *testing.T) {
+	deployment := decodeObjects(t, canaryDeploymentYaml)[0]
+	_, err := canaryOf(deployment, "120")
+	assert.Error(t, err)
+}
+
+func TestAnalyse(t *testing.T) {
+	stub := metricsctl.NewStubServer(0)
+	stub.Set("errors", 0.2)
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	canary.metrics = metricsctl.NewClient(server.URL, time.Second)
+	canary.threshold = 0.1
+	canary.interval = 10 * time.Millisecond
+	defer func() { canary.metrics = nil }()
+
+	assert.NoError(t, analyse("healthy", time.Now().Add(30*time.Millisecond)))
+	assert.Error(t, analyse("errors", time.Now().Add(30*time.Millisecond)))
+}
+
+func TestWithoutAbortedCanaries(t *testing.T) {
+	result := newResult()
+	run, first := result.claimCanary("rest-ha/rest-app")
+	assert.True(t, first)
+	run.finish(true)
+	manifests := decodeObjects(t, canaryDeploymentYaml+`---
+kind: Service
+metadata: {name: rest-app, namespace: rest-ha}
+`)
+
+	kept := withoutAbortedCanaries(manifests, manifests, result)
+	if assert.Len(t, kept, 1) {
+		assert.Equal(t, "Service", kept[0].Kind)
+	}
+}
+
+func TestWithoutAbortedCanaries_NotSelected(t *testing.T) {
+	result := newResult()
+	// canary of another group still running
+	_, first := result.claimCanary("rest-ha/rest-app")
+	assert.True(t, first)
+	manifests := decodeObjects(t, canaryDeploymentYaml)
+
+	kept := withoutAbortedCanaries(manifests, nil, result)
+	assert.Len(t, kept, 1)
+}
+
+func TestClaimCanary_Once(t *testing.T) {
+	result := newResult()
+	run, first := result.claimCanary("rest-ha/rest-app")
+	assert.True(t, first)
+	_, again := result.claimCanary("rest-ha/rest-app")
+	assert.False(t, again)
+
+	go run.finish(false)
+	assert.False(t, result.canaryAborted("rest-ha/rest-app"))
+	assert.False(t, result.canaryAborted("rest-ha/other-app"))
+}
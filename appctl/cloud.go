@@ -0,0 +1,74 @@
+package appctl
+
+import (
+	"fmt"
+	"github.com/anliksim/bsc-deployer/config"
+	"github.com/anliksim/bsc-deployer/policy"
+)
+
+// kubernetes cluster apps are deployed to, identified by its
+// kubectl context which also names the cloud-env label and overlay
+type cloud struct {
+	context string
+}
+
+// private first for all operations
+var clouds = []cloud{{context: privateContext}, {context: publicContext}}
+
+// region and residency of the clouds by context
+var cloudMetadata map[string]config.CloudConfig
+
+func (c cloud) label() string {
+	return fmt.Sprintf(cloudEnvLabel, c.context)
+}
+
+func (c cloud) selector() string {
+	return fmt.Sprintf(eqSelector, c.label(), supportedValue)
+}
+
+func (c cloud) notSelector() string {
+	return fmt.Sprintf(neSelector, c.label(), supportedValue)
+}
+
+// clouds with the given names in the order of the clouds
+func cloudsNamed(names []string) []cloud {
+	var named []cloud
+	for _, c := range clouds {
+		for _, name := range names {
+			if c.context == name {
+				named = append(named, c)
+				break
+			}
+		}
+	}
+	return named
+}
+
+// clouds with the metadata policies are evaluated against
+func policyClouds() []policy.Cloud {
+	var policyClouds []policy.Cloud
+	for _, c := range clouds {
+		metadata := cloudMetadata[c.context]
+		policyClouds = append(policyClouds, policy.Cloud{Name: c.context, Region: metadata.Region, Residency: metadata.Residency})
+	}
+	return policyClouds
+}
+
+func otherClouds(targets []cloud) []cloud {
+	var others []cloud
+	for _, c := range clouds {
+		if !containsCloud(targets, c) {
+			others = append(others, c)
+		}
+	}
+	return others
+}
+
+func containsCloud(list []cloud, c cloud) bool {
+	for _, l := range list {
+		if l == c {
+			return true
+		}
+	}
+	return false
+}
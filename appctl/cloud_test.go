@@ -0,0 +1,37 @@
+package appctl
+
+import (
+	"github.com/anliksim/bsc-deployer/config"
+	"github.com/anliksim/bsc-deployer/policy"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var private = cloud{context: privateContext}
+var public = cloud{context: publicContext}
+
+func TestCloudsNamed(t *testing.T) {
+	assert.Equal(t, []cloud{private, public}, cloudsNamed([]string{publicContext, privateContext}))
+	assert.Equal(t, []cloud{public}, cloudsNamed([]string{publicContext, "unknown"}))
+	assert.Empty(t, cloudsNamed(nil))
+}
+
+func TestPolicyClouds(t *testing.T) {
+	cloudMetadata = map[string]config.CloudConfig{publicContext: {Region: "westeurope", Residency: "eu"}}
+	defer func() { cloudMetadata = nil }()
+
+	assert.Equal(t, []policy.Cloud{
+		{Name: privateContext},
+		{Name: publicContext, Region: "westeurope", Residency: "eu"},
+	}, policyClouds())
+}
+
+func TestOtherClouds(t *testing.T) {
+	assert.Equal(t, []cloud{private}, otherClouds([]cloud{public}))
+	assert.Equal(t, clouds, otherClouds(nil))
+}
+
+func TestSelectors(t *testing.T) {
+	assert.Equal(t, "cloud-env-minikube==supported", private.selector())
+	assert.Equal(t, "cloud-env-bsc-aks!=supported", public.notSelector())
+}
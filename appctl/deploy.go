@@ -2,10 +2,14 @@ package appctl
 
 import (
 	"fmt"
+	"github.com/anliksim/bsc-deployer/appctl/helmctl"
 	"github.com/anliksim/bsc-deployer/appctl/kubectl"
 	"github.com/anliksim/bsc-deployer/appctl/legacyctl"
+	"github.com/anliksim/bsc-deployer/appctl/sopsctl"
+	"github.com/anliksim/bsc-deployer/config"
 	"log"
 	"strings"
+	"time"
 )
 
 const privateContext = "minikube"
@@ -16,46 +20,192 @@ const supportedValue = "supported"
 const eqSelector = "%s==%s"
 const neSelector = "%s!=%s"
 
-var privateLabel = fmt.Sprintf(cloudEnvLabel, privateContext)
-var publicLabel = fmt.Sprintf(cloudEnvLabel, publicContext)
+var renderers = config.Renderers{Kustomize: kubectl.Kustomize, Helm: helmctl.Template}
 
-var privateSelector = fmt.Sprintf(eqSelector, privateLabel, supportedValue)
-var notPrivateSelector = fmt.Sprintf(neSelector, privateLabel, supportedValue)
-var publicSelector = fmt.Sprintf(eqSelector, publicLabel, supportedValue)
-var notPublicSelector = fmt.Sprintf(neSelector, publicLabel, supportedValue)
+var legacyClient = legacyctl.NewClient(legacyctl.DefaultTimeout, legacyctl.DefaultRetries)
+var legacyHosts []string
+var legacyPools map[string][]string
 
-func DeployAll(dirPath string) {
-	deployCloud(dirPath)
-	legacyctl.Apply(dirPath)
+const defaultVerifyTimeout = 5 * time.Minute
+const defaultRolloutTimeout = 5 * time.Minute
+
+// time to wait for the rollout of a changed workload unless set per workload
+var rolloutTimeout = defaultRolloutTimeout
+
+// time to wait for legacy processes to run after apply, no verification if zero
+var verifyTimeout time.Duration
+
+// applies the deployer config, must be called before any deployment
+func Configure(deployerConfig *config.DeployerConfig) {
+	timeout := legacyctl.DefaultTimeout
+	if deployerConfig.Legacy.TimeoutSeconds > 0 {
+		timeout = time.Duration(deployerConfig.Legacy.TimeoutSeconds) * time.Second
+	}
+	retries := legacyctl.DefaultRetries
+	if deployerConfig.Legacy.Retries != nil {
+		retries = *deployerConfig.Legacy.Retries
+	}
+	legacyClient = legacyctl.NewClient(timeout, retries)
+	legacyHosts = deployerConfig.Legacy.Hosts
+	legacyPools = deployerConfig.Legacy.Pools
+	rolloutTimeout = defaultRolloutTimeout
+	if deployerConfig.Rollout.TimeoutSeconds > 0 {
+		rolloutTimeout = time.Duration(deployerConfig.Rollout.TimeoutSeconds) * time.Second
+	}
+	configureProgressive(deployerConfig.Progressive)
+	configureCanary(deployerConfig.Canary)
+	configureDeletionGuard(deployerConfig.Deletion)
+	cloudMetadata = deployerConfig.Clouds
+	parallelism = defaultParallelism
+	if deployerConfig.Parallelism > 0 {
+		parallelism = deployerConfig.Parallelism
+	}
+	verifyTimeout = 0
+	if deployerConfig.Verification.Enabled {
+		verifyTimeout = defaultVerifyTimeout
+		if deployerConfig.Verification.TimeoutSeconds > 0 {
+			verifyTimeout = time.Duration(deployerConfig.Verification.TimeoutSeconds) * time.Second
+		}
+	}
+}
+
+func DeployAll(request Request) *Result {
+	result := newResult()
+	planned := newDeletions()
+	legacy, err := loadManifests(request, legacyctl.Target)
+	prune := false
+	if err != nil {
+		result.addError(err)
+	} else {
+		prune = countLegacyDeletions(legacy, &planned, result)
+	}
+	placements, allowed := deployCloud(request, planned, result)
+	if allowed && err == nil {
+		deployLegacy(legacy, prune, result)
+	} else {
+		// blocked by the deletion guard, nothing to verify
+		legacy = nil
+	}
+	if verifyTimeout > 0 {
+		verifyAndRollBack(request, placements, legacy, result)
+	}
 	// switch to private for safety reasons
 	_, _ = kubectl.SetContext(privateContext)
+	return result
 }
 
-func DeleteAll(dirPath string) {
-	kubectl.DeleteDir(appsPath(dirPath))
+func DeleteAll(request Request) *Result {
+	result := newResult()
+	dirPath := request.Dir
+	// deleting only needs names and labels, so it works without the sops keys
+	if manifests, err := loadManifestsWithoutSecrets(request, privateContext); err == nil {
+		result.addError(kubectl.DeleteWithSelector(privateContext, manifests, ""))
+	} else {
+		result.addError(err)
+	}
 	kubectl.DeleteDir(policiesPath(dirPath))
-	kubectl.DeleteDir(namespacesPath(dirPath))
-	legacyctl.Delete(dirPath)
+	if namespaces, err := loadNamespaces(dirPath, request.Rev); err == nil {
+		deleteNamespaces(cloud{context: privateContext}, namespaces, result)
+	} else {
+		result.addError(err)
+	}
+	if manifests, err := loadManifestsWithoutSecrets(request, legacyctl.Target); err == nil {
+		result.addErrors(legacyctl.Delete(legacyClient, manifests, legacyPools))
+	} else {
+		result.addError(err)
+	}
 
 	// switch to private for safety reasons
 	_, _ = kubectl.SetContext(privateContext)
+	return result
 }
 
-func deployCloud(dirPath string) {
+// deploys the namespaces, policies and apps to the clouds, returns
+// the groups applied per cloud and whether the deletion guard passed
+func deployCloud(request Request, planned deletions, result *Result) ([]placement, bool) {
 	checkVersions()
-	deployPolicies(dirPath)
-	deployApps(dirPath)
+	namespaces, err := loadNamespaces(request.Dir, request.Rev)
+	if err != nil {
+		result.addError(err)
+		// the legacy deletions are guarded nevertheless
+		return nil, allowDeletions(request, planned, result)
+	}
+	removals := plannedNamespaceRemovals(namespaces, result)
+	for _, removal := range removals {
+		planned.addCount(removal.cloud.context, removal.objects+1)
+	}
+	deployPolicies(request.Dir, namespaces, result)
+	placements, allowed := deployApps(request, planned, result)
+	if !allowed {
+		return placements, false
+	}
+	// once the apps moved, namespaces removed from the env repo go as well
+	if len(removals) > 0 && result.Failed() {
+		log.Printf("Keeping namespaces removed from the env repo, the deployment failed")
+		return placements, true
+	}
+	pruneNamespaces(removals, result)
+	return placements, true
+}
+
+func deployLegacy(manifests []config.Object, prune bool, result *Result) {
+	result.addErrors(legacyctl.Apply(legacyClient, manifests, legacyPools))
+	if prune {
+		// stop processes removed from the env repo
+		result.addErrors(legacyctl.Prune(legacyClient, manifests, legacyPools, legacyHosts))
+	}
+}
+
+// renders the apps for the target cloud or legacy with the variables
+// and secrets of the target from the env repo and stamps the request
+func loadManifests(request Request, target string) ([]config.Object, error) {
+	return loadManifestsWith(request, target, sopsctl.Decrypt)
+}
+
+// templated secrets render empty
+func loadManifestsWithoutSecrets(request Request, target string) ([]config.Object, error) {
+	return loadManifestsWith(request, target, nil)
+}
+
+func loadManifestsWith(request Request, target string, decrypt func(file string) ([]byte, error)) ([]config.Object, error) {
+	variables, err := config.LoadVariables(request.Dir, target, request.Rev, decrypt)
+	if err != nil {
+		return nil, err
+	}
+	manifests, err := config.LoadManifests(appsPath(request.Dir), config.LoadOptions{
+		Target:    target,
+		Renderers: renderers,
+		Variables: variables,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stamp(manifests, request, time.Now())
+}
+
+// manifests applied to all clouds alike, e.g. namespaces and policies, templates
+// are rendered with the variables of the private cloud without secrets
+func loadEnvManifests(manifestsDir string, envDir string, rev string) ([]config.Object, error) {
+	variables, err := config.LoadVariables(envDir, privateContext, rev, nil)
+	if err != nil {
+		return nil, err
+	}
+	return config.LoadManifests(manifestsDir, config.LoadOptions{
+		Target:    privateContext,
+		Renderers: renderers,
+		Variables: variables,
+	})
 }
 
 // requires k8s 1.60.0 server version
-func deployPolicies(dirPath string) {
+func deployPolicies(dirPath string, namespaces []config.Object, result *Result) {
 	if _, err := kubectl.SetContext(publicContext); err == nil {
-		kubectl.SetUpNamespaces(dirPath)
+		result.addError(setUpNamespaces(cloud{context: publicContext}, namespaces))
 		// Azure AKS runs v1.15.10
 		// thus skipping public cloud
 	}
 	if _, err := kubectl.SetContext(privateContext); err == nil {
-		kubectl.SetUpNamespaces(dirPath)
+		result.addError(setUpNamespaces(cloud{context: privateContext}, namespaces))
 		kubectl.DeployPolicies(dirPath)
 	}
 }
@@ -83,93 +233,117 @@ func namespacesPath(dirPath string) string {
 	return dirPath + "/namespaces"
 }
 
-func hasPrivate(labelString string) bool {
-	return strings.Contains(labelString, privateLabel)
+func selectorString(selectors ...string) string {
+	return strings.Join(selectors, ",")
 }
 
-func hasPublic(labelString string) bool {
-	return strings.Contains(labelString, publicLabel)
+func groupSelector(cg string) string {
+	return fmt.Sprintf(eqSelector, groupLabel, cg)
 }
 
-func selectorString(selectors ...string) string {
-	return strings.Join(selectors, ",")
+// selectors of the objects of the group supported and not supported on cloud as
+func groupSelectors(cg string, as cloud) (string, string) {
+	return selectorString(groupSelector(cg), as.selector()), selectorString(groupSelector(cg), as.notSelector())
 }
 
-func deployApps(dirPath string) {
-
-	log.Printf("Deploying apps to private cloud...")
-	appPath := appsPath(dirPath)
-	strategies := kubectl.GetDeploymentStrategies()
-	for cg, labels := range strategies {
-		log.Printf("Deploying cloud group %s to %s...", cg, labels)
-
-		labelString := strings.Join(labels, " ")
-		cgSelector := fmt.Sprintf(eqSelector, groupLabel, cg)
-
-		privateForGroup := selectorString(cgSelector, privateSelector)
-		notPrivateForGroup := selectorString(cgSelector, notPrivateSelector)
-		publicForGroup := selectorString(cgSelector, publicSelector)
-		notPublicForGroup := selectorString(cgSelector, notPublicSelector)
-
-		// handle private and public policy first
-		if hasPrivate(labelString) && hasPublic(labelString) {
-
-			// deploy apps to private
-			if _, err := kubectl.SetContext(privateContext); err == nil {
-				kubectl.ApplyWithSelector(appPath, privateForGroup)
-				// delete apps in case private changed to unsupported
-				kubectl.DeleteWithSelector(appPath, notPrivateForGroup)
-			}
-
-			// deploy apps to public
-			if _, err := kubectl.SetContext(publicContext); err == nil {
-				kubectl.ApplyWithSelector(appPath, publicForGroup)
-				// delete apps in case public changed to unsupported
-				kubectl.DeleteWithSelector(appPath, notPublicForGroup)
-			}
-
-			// handle private only policy
-		} else if hasPrivate(labelString) {
-
-			// deploy apps to private
-			if _, err := kubectl.SetContext(privateContext); err == nil {
-				kubectl.ApplyWithSelector(appPath, privateForGroup)
-				// delete apps in case private changed to unsupported
-				kubectl.DeleteWithSelector(appPath, notPrivateForGroup)
-			}
-
-			// delete apps in case it was on public before
-			if _, err := kubectl.SetContext(publicContext); err == nil {
-				kubectl.DeleteWithSelector(appPath, cgSelector)
-			}
-
-			// handle public only policy
-		} else if hasPublic(labelString) {
-
-			// deploy apps to public
-			if _, err := kubectl.SetContext(publicContext); err == nil {
-				kubectl.ApplyWithSelector(appPath, publicForGroup)
-				// delete apps in case public changed to unsupported
-				kubectl.DeleteWithSelector(appPath, notPublicForGroup)
-			}
-
-			// delete apps in case it was on private before
-			if _, err := kubectl.SetContext(privateContext); err == nil {
-				kubectl.DeleteWithSelector(appPath, cgSelector)
-			}
-
-			//	handle none policy
-		} else {
-
-			// delete apps in case it was on private before
-			if _, err := kubectl.SetContext(privateContext); err == nil {
-				kubectl.DeleteWithSelector(appPath, cgSelector)
-			}
-
-			// delete apps in case it was on public before
-			if _, err := kubectl.SetContext(publicContext); err == nil {
-				kubectl.DeleteWithSelector(appPath, cgSelector)
-			}
+// applies the cloud-groups to the clouds their policies support in the order of their
+// dependencies, the clouds and independent groups in parallel, returns the groups applied
+// per cloud and whether the deletion guard passed for the planned and the cloud deletions
+func deployApps(request Request, planned deletions, result *Result) ([]placement, bool) {
+	// nothing applied, the other deletions are guarded nevertheless
+	abort := func(err error) ([]placement, bool) {
+		result.addError(err)
+		return nil, allowDeletions(request, planned, result)
+	}
+
+	manifests := make(map[string][]config.Object)
+	for _, c := range clouds {
+		// each cloud gets its own kustomize overlay
+		loaded, err := loadManifests(request, c.context)
+		if err != nil {
+			return abort(err)
+		}
+		manifests[c.context] = loaded
+	}
+
+	policies, err := kubectl.GetGroupPolicies()
+	if err != nil {
+		return abort(err)
+	}
+	dependencies, err := kubectl.GetGroupDependencies()
+	if err != nil {
+		return abort(err)
+	}
+	health := cloudHealth()
+	groups := make([]string, 0, len(policies))
+	targets := make(map[string][]target)
+	for cg, p := range policies {
+		groups = append(groups, cg)
+		placed := evaluateGroup(cg, p, health)
+		result.addDecisions(placed.decisions)
+		result.addErrors(placed.errs)
+		if !placed.evaluated {
+			continue
+		}
+		labelled, decisions, err := labelledTargets(cg, placed.targets, manifests)
+		result.addDecisions(decisions)
+		if err != nil {
+			// neither applied nor deleted, same as an unsatisfiable policy
+			result.addError(err)
+			continue
+		}
+		targets[cg] = labelled
+	}
+	waves, err := dependencyWaves(groups, dependencies)
+	if err != nil {
+		return abort(err)
+	}
+	available := healthyClouds(health)
+
+	initial, promotion := planStages(targets)
+	fromClouds, err := cloudDeletions([]map[string]map[string]action{initial, promotion}, manifests, available)
+	if err != nil {
+		result.addError(err)
+		return nil, false
+	}
+	planned.add(fromClouds)
+	if !allowDeletions(request, planned, result) {
+		return nil, false
+	}
+	runner := newCloudRunner(request, manifests, waves, dependencies, result)
+	defer func() {
+		result.setClouds(runner.cloudResults())
+	}()
+	runner.run(initial, available)
+	if len(promotion) == 0 {
+		return runner.placements, true
+	}
+	failed := runner.failedGroups()
+	promoted := gatePromotion(request, stageGroups(promotion, actionApply), runner.placements, failed, result)
+	// groups without promotion are deleted from the other clouds unless they failed
+	for cg := range stageGroups(promotion, actionDelete) {
+		if _, gated := promoted[cg]; !gated {
+			promoted[cg] = !failed[cg]
+		}
+		if !promoted[cg] {
+			log.Printf("Keeping cloud group %s on the other clouds as it was not deployed", cg)
 		}
 	}
+	log.Printf("Promoting cloud groups and removing them from the other clouds...")
+	runner.run(onlyGroups(promotion, promoted), available)
+	return runner.placements, true
+}
+
+// applies the objects of the group supported on cloud as to cloud c after the canaries of its
+// deployments, waits for its rollouts and deletes the apps of the group no longer supported
+func applyGroup(request Request, c cloud, as cloud, cg string, manifests []config.Object, result *Result) placement {
+	selector, notSelector := groupSelectors(cg, as)
+	manifests = runCanaries(request, c, manifests, selector, result)
+	changed, err := kubectl.ApplyWithSelector(c.context, manifests, selector)
+	result.addError(err)
+	result.addRollouts(c, cg, kubectl.WaitForRollouts(c.context, changed, rolloutTimeout))
+	applied, _ := config.SelectObjects(manifests, selector)
+	// delete apps in case the cloud changed to unsupported for some of them
+	result.addError(kubectl.DeleteWithSelector(c.context, manifests, notSelector))
+	return placement{cloud: c, as: as, group: cg, objects: applied}
 }
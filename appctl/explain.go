@@ -0,0 +1,132 @@
+package appctl
+
+import (
+	"github.com/anliksim/bsc-deployer/appctl/kubectl"
+	"github.com/anliksim/bsc-deployer/config"
+	"github.com/anliksim/bsc-deployer/policy"
+	"sort"
+)
+
+const actionSkip = "skip"
+
+// placement of a cloud-group as a deployment would compute it
+type GroupPlacement struct {
+	Group string
+	// namespace/name of the cpols of the group
+	Cpols  []string
+	Policy policy.Policy
+	// clouds the policy selects before failovers
+	Targets []string
+	Reasons []string
+	Errors  []string
+	Clouds  []CloudSelectors
+}
+
+// objects of a group applied to and deleted from a cloud
+type CloudSelectors struct {
+	Cloud string
+	// apply, delete or skip if the cloud is not healthy
+	Action string
+	// empty if the group is deleted from the cloud
+	Apply  string
+	Delete string
+}
+
+// computes the placement of the cloud-groups from the cpols in the cluster, or from the
+// policies and apps of the env repo in dir if set, and the health of the clouds without
+// changing them, without apps the objects are assumed to be labelled for their targets
+func Placements(dir string) ([]GroupPlacement, error) {
+	var cpols []config.Object
+	var err error
+	manifests := make(map[string][]config.Object)
+	if dir == "" {
+		cpols, err = kubectl.GetCpols()
+	} else {
+		cpols, err = loadEnvManifests(policiesPath(dir)+"/definitions", dir, "")
+		for _, c := range clouds {
+			if err != nil {
+				break
+			}
+			// labels only, secrets are not needed
+			manifests[c.context], err = loadManifestsWithoutSecrets(Request{Dir: dir}, c.context)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	policies, err := kubectl.GroupPolicies(cpols)
+	if err != nil {
+		return nil, err
+	}
+	return explainPlacements(cpols, policies, manifests, cloudHealth()), nil
+}
+
+func explainPlacements(cpols []config.Object, policies map[string]policy.Policy,
+	manifests map[string][]config.Object, health map[string]string) []GroupPlacement {
+	placements := make([]GroupPlacement, 0, len(policies))
+	for cg, p := range policies {
+		placed := evaluateGroup(cg, p, health)
+		placement := GroupPlacement{
+			Group:   cg,
+			Cpols:   groupCpols(cpols, cg),
+			Policy:  p,
+			Targets: placed.decision.Targets,
+			Reasons: append(placed.reasons, placed.decisions...),
+		}
+		for _, err := range placed.errs {
+			placement.Errors = append(placement.Errors, err.Error())
+		}
+		if placed.evaluated {
+			// same as deployApps
+			labelled, decisions, err := labelledTargets(cg, placed.targets, manifests)
+			placement.Reasons = append(placement.Reasons, decisions...)
+			if err != nil {
+				placement.Errors = append(placement.Errors, err.Error())
+			} else {
+				placement.Clouds = cloudSelectors(cg, labelled, health)
+			}
+		}
+		placements = append(placements, placement)
+	}
+	sort.Slice(placements, func(i, j int) bool {
+		return placements[i].Group < placements[j].Group
+	})
+	return placements
+}
+
+// selectors applied and deleted per cloud in the order of the clouds, promotions included
+func cloudSelectors(cg string, targets []target, health map[string]string) []CloudSelectors {
+	initial, promotion := planStages(map[string][]target{cg: targets})
+	var selectors []CloudSelectors
+	for _, c := range clouds {
+		if health[c.context] != cloudHealthy {
+			selectors = append(selectors, CloudSelectors{Cloud: c.context, Action: actionSkip})
+			continue
+		}
+		a, ok := initial[c.context][cg]
+		if !ok {
+			a = promotion[c.context][cg]
+		}
+		s := CloudSelectors{Cloud: c.context, Action: a.kind, Delete: groupSelector(cg)}
+		if a.kind == actionApply {
+			s.Apply, s.Delete = groupSelectors(cg, a.as)
+		}
+		selectors = append(selectors, s)
+	}
+	return selectors
+}
+
+func groupCpols(cpols []config.Object, cg string) []string {
+	var names []string
+	for _, cpol := range cpols {
+		if cpol.Labels[groupLabel] != cg {
+			continue
+		}
+		if cpol.Namespace == "" {
+			names = append(names, cpol.Name)
+			continue
+		}
+		names = append(names, cpol.Namespace+"/"+cpol.Name)
+	}
+	return names
+}
@@ -0,0 +1,88 @@
+package appctl
+
+import (
+	"github.com/anliksim/bsc-deployer/config"
+	"github.com/anliksim/bsc-deployer/policy"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExplainPlacements(t *testing.T) {
+	cpols := []config.Object{
+		{Name: "rest", Namespace: "rest", Labels: map[string]string{groupLabel: "rest"}},
+		{Name: "monitoring", Labels: map[string]string{groupLabel: "monitoring"}},
+	}
+	policies := map[string]policy.Policy{
+		"rest":       {Labels: []string{"cloud-env-minikube"}},
+		"monitoring": {Required: []string{"unknown"}},
+	}
+	health := map[string]string{privateContext: cloudHealthy, publicContext: cloudHealthy}
+
+	placements := explainPlacements(cpols, policies, nil, health)
+	assert.Equal(t, []GroupPlacement{
+		{
+			Group:  "monitoring",
+			Cpols:  []string{"monitoring"},
+			Policy: policies["monitoring"],
+			Errors: []string{"cloud group monitoring not placed: required cloud unknown is unknown"},
+		},
+		{
+			Group:   "rest",
+			Cpols:   []string{"rest/rest"},
+			Policy:  policies["rest"],
+			Targets: []string{privateContext},
+			Reasons: []string{"rest: minikube required"},
+			Clouds: []CloudSelectors{
+				{
+					Cloud:  privateContext,
+					Action: actionApply,
+					Apply:  "cloud-group==rest,cloud-env-minikube==supported",
+					Delete: "cloud-group==rest,cloud-env-minikube!=supported",
+				},
+				{Cloud: publicContext, Action: actionDelete, Delete: "cloud-group==rest"},
+			},
+		},
+	}, placements)
+}
+
+func TestExplainPlacements_LabelledTargets(t *testing.T) {
+	policies := map[string]policy.Policy{
+		"rest":       {Labels: []string{"cloud-env-minikube"}},
+		"monitoring": {Labels: []string{"cloud-env-minikube"}},
+	}
+	health := map[string]string{privateContext: cloudHealthy, publicContext: cloudHealthy}
+	// rest is only labelled for the public cloud, monitoring for none
+	objects := []config.Object{
+		{Name: "rest-app", Labels: map[string]string{groupLabel: "rest", public.label(): supportedValue}},
+		{Name: "prometheus", Labels: map[string]string{groupLabel: "monitoring"}},
+	}
+	manifests := map[string][]config.Object{privateContext: objects, publicContext: objects}
+
+	placements := explainPlacements(nil, policies, manifests, health)
+	if assert.Len(t, placements, 2) {
+		assert.Equal(t, []string{"cloud group monitoring not placed, none of its objects are labelled for a cloud"},
+			placements[0].Errors)
+		assert.Empty(t, placements[0].Clouds)
+
+		assert.Contains(t, placements[1].Reasons,
+			"rest deployed to minikube with the objects labelled for bsc-aks, none are labelled for minikube")
+		if assert.Len(t, placements[1].Clouds, 2) {
+			assert.Equal(t, "cloud-group==rest,cloud-env-bsc-aks==supported", placements[1].Clouds[0].Apply)
+		}
+	}
+}
+
+func TestCloudSelectors_Failover(t *testing.T) {
+	health := map[string]string{privateContext: cloudUnreachable, publicContext: cloudHealthy}
+
+	selectors := cloudSelectors("rest", []target{{cloud: public, as: private}}, health)
+	assert.Equal(t, []CloudSelectors{
+		{Cloud: privateContext, Action: actionSkip},
+		{
+			Cloud:  publicContext,
+			Action: actionApply,
+			Apply:  "cloud-group==rest,cloud-env-minikube==supported",
+			Delete: "cloud-group==rest,cloud-env-minikube!=supported",
+		},
+	}, selectors)
+}
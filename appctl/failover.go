@@ -0,0 +1,181 @@
+package appctl
+
+import (
+	"fmt"
+	"github.com/anliksim/bsc-deployer/appctl/kubectl"
+	"github.com/anliksim/bsc-deployer/config"
+	"github.com/anliksim/bsc-deployer/policy"
+	"log"
+)
+
+// cpol label allowing a cloud-group to move to another cloud if a target cloud is unreachable
+const failoverLabel = "cloud-failover"
+
+const cloudHealthy = "healthy"
+const cloudUnreachable = "unreachable"
+const cloudNotConfigured = "not configured"
+
+// cloud a group is applied to and the cloud whose cloud-env label
+// selects its objects, which differ after a failover
+type target struct {
+	cloud cloud
+	as    cloud
+}
+
+// state of the clouds by context, clouds without context are not part of the setup
+func cloudHealth() map[string]string {
+	health := make(map[string]string)
+	for _, c := range clouds {
+		switch {
+		case !kubectl.HasContext(c.context):
+			health[c.context] = cloudNotConfigured
+		case kubectl.Healthy(c.context):
+			health[c.context] = cloudHealthy
+		default:
+			health[c.context] = cloudUnreachable
+		}
+		log.Printf("Cloud %s is %s", c.context, health[c.context])
+	}
+	return health
+}
+
+// placement of a group evaluated from its policy and the health of the clouds
+type groupPlacement struct {
+	decision policy.Decision
+	// whether the policy could be satisfied, the group is left as is otherwise
+	evaluated bool
+	targets   []target
+	// why the policy selects its targets, logged only
+	reasons []string
+	// failovers and skipped clouds, recorded with the deployment
+	decisions []string
+	errs      []error
+}
+
+func evaluateGroup(cg string, p policy.Policy, health map[string]string) groupPlacement {
+	var placed groupPlacement
+	decision, err := policy.Evaluate(p, policyClouds())
+	placed.decision = decision
+	placed.reasons = explain(cg, decision)
+	for _, reason := range placed.reasons {
+		log.Print(reason)
+	}
+	if err != nil {
+		// neither applied nor deleted until the policy is fixed
+		placed.errs = append(placed.errs, fmt.Errorf("cloud group %s not placed: %v", cg, err))
+		return placed
+	}
+	log.Printf("Cloud group %s targets %s", cg, decision.Targets)
+	targets, decisions, errs := placeGroup(cg, cloudsNamed(decision.Targets), cloudsNamed(decision.Eligible),
+		containsString(p.Labels, failoverLabel), health)
+	placed.evaluated = true
+	placed.targets = targets
+	placed.decisions = append(placed.decisions, decisions...)
+	placed.errs = append(placed.errs, errs...)
+	return placed
+}
+
+// reasons of the policy decision for the group
+func explain(cg string, decision policy.Decision) []string {
+	var reasons []string
+	for _, reason := range decision.Reasons {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", cg, reason))
+	}
+	return reasons
+}
+
+// targets whose cloud has no objects of the group labelled for it apply the objects
+// labelled for another cloud instead, e.g. clouds added by preferred or minClouds,
+// fails if no objects of the group are labelled for any cloud
+func labelledTargets(cg string, targets []target, manifests map[string][]config.Object) ([]target, []string, error) {
+	var labelled []target
+	var decisions []string
+	for _, t := range targets {
+		// nothing to apply either way
+		groupObjects, _ := config.SelectObjects(manifests[t.cloud.context], groupSelector(cg))
+		if len(groupObjects) == 0 || hasObjects(cg, manifests[t.cloud.context], t.as) {
+			labelled = append(labelled, t)
+			continue
+		}
+		as, found := labelledCloud(cg, manifests[t.cloud.context])
+		if !found {
+			return nil, nil, fmt.Errorf("cloud group %s not placed, none of its objects are labelled for a cloud", cg)
+		}
+		labelled = append(labelled, target{cloud: t.cloud, as: as})
+		decisions = append(decisions, fmt.Sprintf("%s deployed to %s with the objects labelled for %s, none are labelled for %s",
+			cg, t.cloud.context, as.context, t.as.context))
+	}
+	return labelled, decisions, nil
+}
+
+// first cloud with objects of the group labelled for it
+func labelledCloud(cg string, manifests []config.Object) (cloud, bool) {
+	for _, c := range clouds {
+		if hasObjects(cg, manifests, c) {
+			return c, true
+		}
+	}
+	return cloud{}, false
+}
+
+func hasObjects(cg string, manifests []config.Object, as cloud) bool {
+	selector, _ := groupSelectors(cg, as)
+	selected, err := config.SelectObjects(manifests, selector)
+	return err == nil && len(selected) > 0
+}
+
+func healthyClouds(health map[string]string) map[string]bool {
+	healthy := make(map[string]bool)
+	for context, state := range health {
+		healthy[context] = state == cloudHealthy
+	}
+	return healthy
+}
+
+// places the group on its healthy supported clouds, unreachable supported clouds are replaced by healthy
+// eligible clouds the group is not placed on if it allows failover and fail the group otherwise
+func placeGroup(cg string, supported []cloud, eligible []cloud, failover bool, health map[string]string) ([]target, []string, []error) {
+	var targets []target
+	var decisions []string
+	var errs []error
+	placed := func(c cloud) bool {
+		for _, t := range targets {
+			if t.cloud == c {
+				return true
+			}
+		}
+		return containsCloud(supported, c)
+	}
+	for _, c := range supported {
+		switch health[c.context] {
+		case cloudHealthy:
+			targets = append(targets, target{cloud: c, as: c})
+		case cloudNotConfigured:
+			decisions = append(decisions, fmt.Sprintf("%s not deployed to %s, context not configured", cg, c.context))
+		default:
+			alternative, found := alternativeCloud(eligible, placed, health)
+			switch {
+			case failover && found:
+				targets = append(targets, target{cloud: alternative, as: c})
+				decisions = append(decisions, fmt.Sprintf("%s failed over from %s to %s, %s is %s",
+					cg, c.context, alternative.context, c.context, health[c.context]))
+			case failover:
+				errs = append(errs, fmt.Errorf("%s not deployed to %s, %s and no cloud to fail over to",
+					cg, c.context, health[c.context]))
+			default:
+				errs = append(errs, fmt.Errorf("%s not deployed to %s, %s", cg, c.context, health[c.context]))
+			}
+		}
+	}
+	return targets, decisions, errs
+}
+
+// first healthy eligible cloud the group is not placed on
+func alternativeCloud(eligible []cloud, placed func(cloud) bool, health map[string]string) (cloud, bool) {
+	for _, c := range eligible {
+		if health[c.context] == cloudHealthy && !placed(c) {
+			return c, true
+		}
+	}
+	return cloud{}, false
+}
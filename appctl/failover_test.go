@@ -0,0 +1,80 @@
+package appctl
+
+import (
+	"github.com/anliksim/bsc-deployer/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPlaceGroup_Healthy(t *testing.T) {
+	health := map[string]string{privateContext: cloudHealthy, publicContext: cloudHealthy}
+
+	targets, decisions, errs := placeGroup("rest", []cloud{private}, clouds, true, health)
+	assert.Equal(t, []target{{cloud: private, as: private}}, targets)
+	assert.Empty(t, decisions)
+	assert.Empty(t, errs)
+}
+
+func TestPlaceGroup_Failover(t *testing.T) {
+	health := map[string]string{privateContext: cloudUnreachable, publicContext: cloudHealthy}
+
+	targets, decisions, errs := placeGroup("rest", []cloud{private}, clouds, true, health)
+	assert.Equal(t, []target{{cloud: public, as: private}}, targets)
+	assert.Equal(t, []string{"rest failed over from minikube to bsc-aks, minikube is unreachable"}, decisions)
+	assert.Empty(t, errs)
+}
+
+func TestPlaceGroup_WithoutFailover(t *testing.T) {
+	health := map[string]string{privateContext: cloudUnreachable, publicContext: cloudHealthy}
+
+	targets, decisions, errs := placeGroup("rest", []cloud{private}, clouds, false, health)
+	assert.Empty(t, targets)
+	assert.Empty(t, decisions)
+	assert.EqualError(t, errs[0], "rest not deployed to minikube, unreachable")
+}
+
+func TestPlaceGroup_NoAlternative(t *testing.T) {
+	health := map[string]string{privateContext: cloudUnreachable, publicContext: cloudHealthy}
+
+	targets, _, errs := placeGroup("rest-ha", []cloud{private, public}, clouds, true, health)
+	assert.Equal(t, []target{{cloud: public, as: public}}, targets)
+	assert.EqualError(t, errs[0], "rest-ha not deployed to minikube, unreachable and no cloud to fail over to")
+}
+
+func TestPlaceGroup_NotConfigured(t *testing.T) {
+	health := map[string]string{privateContext: cloudHealthy, publicContext: cloudNotConfigured}
+
+	targets, decisions, errs := placeGroup("rest-ha", []cloud{private, public}, clouds, true, health)
+	assert.Equal(t, []target{{cloud: private, as: private}}, targets)
+	assert.Equal(t, []string{"rest-ha not deployed to bsc-aks, context not configured"}, decisions)
+	assert.Empty(t, errs)
+}
+
+func TestPlaceGroup_FailoverOnlyToEligible(t *testing.T) {
+	health := map[string]string{privateContext: cloudUnreachable, publicContext: cloudHealthy}
+
+	targets, _, errs := placeGroup("rest", []cloud{private}, []cloud{private}, true, health)
+	assert.Empty(t, targets)
+	assert.EqualError(t, errs[0], "rest not deployed to minikube, unreachable and no cloud to fail over to")
+}
+
+func TestLabelledTargets(t *testing.T) {
+	objects := []config.Object{
+		{Name: "rest-app", Labels: map[string]string{groupLabel: "rest", private.label(): supportedValue}},
+	}
+	manifests := map[string][]config.Object{privateContext: objects, publicContext: objects}
+	targets := []target{{cloud: private, as: private}, {cloud: public, as: public}}
+
+	labelled, decisions, err := labelledTargets("rest", targets, manifests)
+	assert.NoError(t, err)
+	// bsc-aks was added by the policy but nothing is labelled for it
+	assert.Equal(t, []target{{cloud: private, as: private}, {cloud: public, as: private}}, labelled)
+	assert.Len(t, decisions, 1)
+
+	_, _, err = labelledTargets("monitoring", targets, manifests)
+	assert.NoError(t, err)
+
+	objects[0].Labels = map[string]string{groupLabel: "rest"}
+	_, _, err = labelledTargets("rest", targets, manifests)
+	assert.Error(t, err)
+}
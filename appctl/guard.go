@@ -0,0 +1,202 @@
+package appctl
+
+import (
+	"errors"
+	"fmt"
+	"github.com/anliksim/bsc-deployer/appctl/kubectl"
+	"github.com/anliksim/bsc-deployer/appctl/legacyctl"
+	"github.com/anliksim/bsc-deployer/config"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// limits on the objects a deployment deletes, zero means unlimited
+var deletionGuard struct {
+	maxObjects         int
+	maxObjectsPerCloud int
+	// whether blocked deployments wait for Approve instead of failing
+	approval        bool
+	approvalTimeout time.Duration
+}
+
+func configureDeletionGuard(deletionConfig config.DeletionConfig) {
+	deletionGuard.maxObjects = deletionConfig.MaxObjects
+	deletionGuard.maxObjectsPerCloud = deletionConfig.MaxObjectsPerCloud
+	deletionGuard.approval = deletionConfig.Approval
+	deletionGuard.approvalTimeout = defaultApprovalTimeout
+	if deletionConfig.ApprovalTimeoutSeconds > 0 {
+		deletionGuard.approvalTimeout = time.Duration(deletionConfig.ApprovalTimeoutSeconds) * time.Second
+	}
+}
+
+// deployed objects a deployment would delete
+type deletions struct {
+	total int
+	// by cloud context, legacy processes and configs by legacy target
+	perCloud map[string]int
+	// groups deployed on some cloud the deployment would remove from all clouds
+	removed []string
+}
+
+func newDeletions() deletions {
+	return deletions{perCloud: make(map[string]int)}
+}
+
+func (d *deletions) add(other deletions) {
+	d.total += other.total
+	for target, count := range other.perCloud {
+		d.perCloud[target] += count
+	}
+	d.removed = append(d.removed, other.removed...)
+}
+
+func (d *deletions) addCount(target string, count int) {
+	d.total += count
+	d.perCloud[target] += count
+}
+
+// counts the deployed objects matching the delete selectors of the stages per cloud
+func plannedDeletions(stages []map[string]map[string]action, manifests map[string][]config.Object,
+	deployed map[string][]config.Object) deletions {
+	planned := newDeletions()
+	applied := make(map[string]bool)
+	groups := make(map[string]bool)
+	for _, stage := range stages {
+		for context, actions := range stage {
+			for cg, a := range actions {
+				groups[cg] = true
+				selector := groupSelector(cg)
+				if a.kind == actionApply {
+					applied[cg] = true
+					_, selector = groupSelectors(cg, a.as)
+				}
+				selected, err := config.SelectObjects(manifests[context], selector)
+				if err != nil {
+					log.Printf("Failed to select deletions of %s on %s: %v", cg, context, err)
+					continue
+				}
+				count := countDeployed(selected, deployed[context])
+				planned.perCloud[context] += count
+				planned.total += count
+			}
+		}
+	}
+	for cg := range groups {
+		if !applied[cg] && groupDeployed(cg, deployed) {
+			planned.removed = append(planned.removed, cg)
+		}
+	}
+	sort.Strings(planned.removed)
+	return planned
+}
+
+// number of the objects that are deployed, objects without namespace match any namespace
+func countDeployed(objects []config.Object, deployed []config.Object) int {
+	count := 0
+	for _, o := range objects {
+		for _, d := range deployed {
+			if o.Kind == d.Kind && o.Name == d.Name && (o.Namespace == "" || o.Namespace == d.Namespace) {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+func groupDeployed(cg string, deployed map[string][]config.Object) bool {
+	for _, objects := range deployed {
+		for _, o := range objects {
+			if o.Labels[groupLabel] == cg {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// reasons the guard blocks the deletions, none if they are within the limits
+func (d deletions) violations() []string {
+	var violations []string
+	if deletionGuard.maxObjects > 0 && d.total > deletionGuard.maxObjects {
+		violations = append(violations, fmt.Sprintf("%d objects would be deleted, more than %d",
+			d.total, deletionGuard.maxObjects))
+	}
+	targets := make([]string, 0, len(clouds)+1)
+	for _, c := range clouds {
+		targets = append(targets, c.context)
+	}
+	for _, target := range append(targets, legacyctl.Target) {
+		if count := d.perCloud[target]; deletionGuard.maxObjectsPerCloud > 0 && count > deletionGuard.maxObjectsPerCloud {
+			violations = append(violations, fmt.Sprintf("%d objects would be deleted from %s, more than %d",
+				count, target, deletionGuard.maxObjectsPerCloud))
+		}
+	}
+	for _, cg := range d.removed {
+		violations = append(violations, fmt.Sprintf("cloud group %s would be removed from all clouds", cg))
+	}
+	return violations
+}
+
+// deployed objects the stages delete from the available clouds
+func cloudDeletions(stages []map[string]map[string]action, manifests map[string][]config.Object,
+	available map[string]bool) (deletions, error) {
+	deployed := make(map[string][]config.Object)
+	for _, c := range clouds {
+		if !available[c.context] {
+			continue
+		}
+		objects, err := kubectl.GetGroupObjects(c.context, groupLabel)
+		if err != nil {
+			return deletions{}, fmt.Errorf("failed to count deletions on %s: %v", c.context, err)
+		}
+		deployed[c.context] = objects
+	}
+	return plannedDeletions(stages, manifests, deployed), nil
+}
+
+// legacy orphans counted into the planned deletions, false
+// if they cannot be counted and must not be pruned
+func countLegacyDeletions(legacy []config.Object, planned *deletions, result *Result) bool {
+	count, err := legacyctl.CountOrphans(legacyClient, legacy, legacyPools, legacyHosts)
+	if err != nil {
+		result.addError(fmt.Errorf("not pruning legacy hosts, failed to count deletions: %v", err))
+		return false
+	}
+	planned.addCount(legacyctl.Target, count)
+	return true
+}
+
+// whether the deletions may run, errors of blocked deployments are added to the result
+func allowDeletions(request Request, planned deletions, result *Result) bool {
+	if err := guardDeletions(request, planned, result); err != nil {
+		result.addError(err)
+		return false
+	}
+	return true
+}
+
+// blocks the deployment if it deletes more than allowed, unless forced or approved
+func guardDeletions(request Request, planned deletions, result *Result) error {
+	if request.Force {
+		result.addDecisions([]string{"deletion guard skipped, deployment is forced"})
+		return nil
+	}
+	log.Printf("Deployment deletes %d objects %v", planned.total, planned.perCloud)
+	violations := planned.violations()
+	if len(violations) == 0 {
+		return nil
+	}
+	result.addDecisions(violations)
+	blocked := errors.New("deletion guard: " + strings.Join(violations, ", "))
+	if !deletionGuard.approval {
+		return fmt.Errorf("%v, deploy with force to proceed", blocked)
+	}
+	log.Printf("Deployment %s awaits approval of its deletions for up to %v...", request.Id, deletionGuard.approvalTimeout)
+	if err := awaitApproval(request.Id, deletionGuard.approvalTimeout); err != nil {
+		return fmt.Errorf("%v, %v", blocked, err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package appctl
+
+import (
+	"github.com/anliksim/bsc-deployer/appctl/legacyctl"
+	"github.com/anliksim/bsc-deployer/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func guardObject(kind string, name string, labels map[string]string) config.Object {
+	return config.Object{Kind: kind, Name: name, Namespace: "rest", Labels: labels}
+}
+
+var restPrivate = map[string]string{groupLabel: "rest", "cloud-env-minikube": supportedValue}
+var restPublic = map[string]string{groupLabel: "rest", "cloud-env-bsc-aks": supportedValue}
+
+func TestPlannedDeletions(t *testing.T) {
+	manifests := []config.Object{
+		guardObject("Deployment", "rest", restPrivate),
+		guardObject("Service", "rest", restPrivate),
+		guardObject("Deployment", "rest-public", restPublic),
+	}
+	stages := []map[string]map[string]action{{
+		privateContext: {"rest": {kind: actionApply, as: private}},
+		publicContext:  {"rest": {kind: actionDelete}},
+	}}
+	deployed := map[string][]config.Object{
+		privateContext: {guardObject("Deployment", "rest-public", restPublic)},
+		publicContext:  {guardObject("Deployment", "rest", restPrivate), guardObject("Service", "rest", restPrivate)},
+	}
+
+	planned := plannedDeletions(stages, map[string][]config.Object{privateContext: manifests, publicContext: manifests}, deployed)
+	assert.Equal(t, 3, planned.total)
+	assert.Equal(t, map[string]int{privateContext: 1, publicContext: 2}, planned.perCloud)
+	assert.Empty(t, planned.removed)
+}
+
+func TestPlannedDeletions_RemovedFromAllClouds(t *testing.T) {
+	manifests := []config.Object{guardObject("Deployment", "rest", restPrivate)}
+	stages := []map[string]map[string]action{{
+		privateContext: {"rest": {kind: actionDelete}},
+		publicContext:  {"rest": {kind: actionDelete}},
+	}}
+	deployed := map[string][]config.Object{privateContext: manifests}
+
+	planned := plannedDeletions(stages, map[string][]config.Object{privateContext: manifests, publicContext: manifests}, deployed)
+	assert.Equal(t, 1, planned.total)
+	assert.Equal(t, []string{"rest"}, planned.removed)
+}
+
+func TestDeletions_Violations(t *testing.T) {
+	deletionGuard.maxObjects = 2
+	deletionGuard.maxObjectsPerCloud = 1
+	defer func() { deletionGuard.maxObjects, deletionGuard.maxObjectsPerCloud = 0, 0 }()
+
+	planned := deletions{total: 3, perCloud: map[string]int{privateContext: 1, publicContext: 2}, removed: []string{"rest"}}
+	assert.Equal(t, []string{
+		"3 objects would be deleted, more than 2",
+		"2 objects would be deleted from bsc-aks, more than 1",
+		"cloud group rest would be removed from all clouds",
+	}, planned.violations())
+}
+
+func TestDeletions_LegacyViolations(t *testing.T) {
+	deletionGuard.maxObjectsPerCloud = 1
+	defer func() { deletionGuard.maxObjectsPerCloud = 0 }()
+
+	planned := newDeletions()
+	planned.add(deletions{total: 1, perCloud: map[string]int{privateContext: 1}})
+	planned.addCount(legacyctl.Target, 2)
+	assert.Equal(t, 3, planned.total)
+	assert.Equal(t, []string{"2 objects would be deleted from legacy, more than 1"}, planned.violations())
+}
+
+func TestDeletions_WithinLimits(t *testing.T) {
+	planned := deletions{total: 30, perCloud: map[string]int{publicContext: 30}}
+	assert.Empty(t, planned.violations())
+}
+
+func TestGuardDeletions_Forced(t *testing.T) {
+	result := newResult()
+	planned := newDeletions()
+	planned.addCount(privateContext, 100)
+	assert.NoError(t, guardDeletions(Request{Force: true}, planned, result))
+	assert.Equal(t, []string{"deletion guard skipped, deployment is forced"}, result.Decisions)
+}
@@ -0,0 +1,65 @@
+package helmctl
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/anliksim/bsc-deployer/config"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"path"
+	"sort"
+	"strings"
+)
+
+const notesFile = "NOTES.txt"
+
+// renders the chart like helm template with the helm sdk, works without a cluster,
+// values.yaml of the chart is used anyway and the values files override it in order
+func Template(chart *config.HelmChart, valuesFiles []string) ([]byte, error) {
+	loaded, err := loader.Load(chart.Dir)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{})
+	for _, file := range valuesFiles {
+		fileValues, err := chartutil.ReadValuesFile(file)
+		if err != nil {
+			return nil, err
+		}
+		values = chartutil.CoalesceTables(fileValues.AsMap(), values)
+	}
+	options := chartutil.ReleaseOptions{
+		Name:      chart.Release,
+		Namespace: chart.Namespace,
+		Revision:  1,
+		IsInstall: true,
+	}
+	renderValues, err := chartutil.ToRenderValues(loaded, values, options, chartutil.DefaultCapabilities)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := engine.Render(loaded, renderValues)
+	if err != nil {
+		return nil, err
+	}
+	return joinManifests(rendered), nil
+}
+
+// joins the rendered templates sorted by name into a multi document yaml,
+// skipping the notes and empty templates like helm does
+func joinManifests(rendered map[string]string) []byte {
+	names := make([]string, 0, len(rendered))
+	for name, content := range rendered {
+		if path.Base(name) == notesFile || strings.TrimSpace(content) == "" {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var out bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&out, "---\n# Source: %s\n%s\n", name, rendered[name])
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,46 @@
+package helmctl
+
+import (
+	"github.com/anliksim/bsc-deployer/config"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+var testChartDir = filepath.Join("..", "..", "config", "testdata", "apps", "ingress")
+
+func TestTemplate(t *testing.T) {
+	chart, err := config.LoadHelmChart(testChartDir)
+	assert.NoError(t, err)
+
+	rendered, err := Template(chart, nil)
+	assert.NoError(t, err)
+	objects, err := config.DecodeObjects(rendered)
+	assert.NoError(t, err)
+	if assert.Len(t, objects, 2) {
+		assert.Equal(t, "ingress-controller", objects[0].Name)
+		assert.Contains(t, string(objects[0].Raw), `"replicas":1`)
+		assert.Equal(t, "IngressClass", objects[1].Kind)
+	}
+}
+
+func TestTemplate_ClusterScopedNamespace(t *testing.T) {
+	objects, err := config.LoadManifests(testChartDir, config.LoadOptions{
+		Target:    "minikube",
+		Renderers: config.Renderers{Helm: Template},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, objects, 2) {
+		assert.Equal(t, "ingress", objects[0].Namespace)
+		assert.Equal(t, "", objects[1].Namespace)
+	}
+}
+
+func TestTemplate_TargetValues(t *testing.T) {
+	chart, err := config.LoadHelmChart(testChartDir)
+	assert.NoError(t, err)
+
+	rendered, err := Template(chart, chart.ValuesFiles("bsc-aks"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(rendered), "replicas: 2")
+}
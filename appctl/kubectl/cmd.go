@@ -3,10 +3,12 @@ package kubectl
 import (
 	"bytes"
 	"fmt"
+	"github.com/anliksim/bsc-deployer/config"
 	"github.com/anliksim/bsc-deployer/util"
 	"log"
 	"os/exec"
 	"strings"
+	"time"
 )
 
 func DeployPolicies(dirPath string) {
@@ -22,30 +24,170 @@ func policiesPath(dirPath string) string {
 	return dirPath + "/policies"
 }
 
-// builds a map of cloud-group -> labels
-// e.g. monitoring -> [cloud-private]
-func GetDeploymentStrategies() map[string][]string {
-	strategies := make(map[string][]string)
-	for _, cg := range GetAllCloudGroupsFromCpols() {
-		strategies[cg] = GetCpolLabelsForCloudGroup(cg)
+// applies the manifests matching the selector to the context, same as kubectl apply
+// -f dir -R -l selector, returns the workloads created or whose spec the apply changed
+func ApplyWithSelector(context string, manifests []config.Object, selector string) ([]config.Object, error) {
+	workloads, err := config.SelectObjects(Workloads(manifests), selector)
+	if err != nil {
+		return nil, err
 	}
-	return strategies
+	before := getLive(context, workloads)
+	selected, output, err := withSelected(context, manifests, selector, "apply", "-f", "-")
+	changed := changedWorkloads(output, selected)
+	return specChanged(changed, before, getLive(context, changed)), err
 }
 
-func ApplyWithSelector(appPath string, selector string) {
-	_, _ = kubectlOpts(true, false, "apply", "-f", appPath, "-R", "-l", selector)
+// the live objects of the manifests that exist, none if they cannot be read
+func getLive(context string, manifests []config.Object) []config.Object {
+	if len(manifests) == 0 {
+		return nil
+	}
+	out, err := kubectlInput(false, false, config.EncodeList(manifests),
+		"--context", context, "get", "-f", "-", "--ignore-not-found", "-o", "json")
+	if err != nil {
+		log.Printf("Failed to read live objects from %s: %v", context, err)
+		return nil
+	}
+	live, err := config.DecodeObjects([]byte(out))
+	if err != nil {
+		log.Printf("Failed to read live objects from %s: %v", context, err)
+		return nil
+	}
+	return live
 }
 
-func DeleteWithSelector(appPath string, selector string) {
-	_, _ = kubectlOpts(true, false, "delete", "-f", appPath, "-R", "-l", selector)
+// deletes the manifests matching the selector from the context, same as kubectl delete -f dir -R -l selector
+func DeleteWithSelector(context string, manifests []config.Object, selector string) error {
+	_, _, err := withSelected(context, manifests, selector, "delete", "-f", "-", "--ignore-not-found")
+	return err
 }
 
-func SetContext(context string) (string, error) {
-	return kubectlOpts(true, false, "config", "use-context", context)
+func withSelected(context string, manifests []config.Object, selector string, arg ...string) ([]config.Object, string, error) {
+	selected, err := config.SelectObjects(manifests, selector)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(selected) == 0 {
+		log.Printf("No manifests match %s on %s", selector, context)
+		return nil, "", nil
+	}
+	output, err := kubectlInput(true, false, config.EncodeList(selected), append([]string{"--context", context}, arg...)...)
+	return selected, output, err
+}
+
+// whether the api server of the context answers its health check in time
+func Healthy(context string) bool {
+	_, err := kubectlOpts(false, false, "--context", context, "--request-timeout", "5s", "get", "--raw", "/healthz")
+	return err == nil
+}
+
+// whether the context is configured, e.g. to skip clouds not set up locally
+func HasContext(context string) bool {
+	_, err := kubectlOpts(false, false, "config", "get-contexts", context)
+	return err == nil
+}
+
+// kinds read back from the clusters, e.g. to report deployed revisions
+const groupObjectKinds = "deployments,statefulsets,daemonsets,cronjobs,services,configmaps,ingresses"
+
+// namespaced resources not telling whether a namespace is in use
+var transientResources = map[string]bool{
+	"events":               true,
+	"events.events.k8s.io": true,
+}
+
+// objects carrying the label in all namespaces of the context,
+// does not switch the current context
+func GetGroupObjects(context string, label string) ([]config.Object, error) {
+	out, err := kubectlOpts(false, false, "--context", context,
+		"get", groupObjectKinds, "--all-namespaces", "-l", label, "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+	return config.DecodeObjects([]byte(out))
+}
+
+// namespaces matching the selector, all if empty, does not switch the current context
+func GetNamespaces(context string, selector string) ([]config.Object, error) {
+	arg := []string{"--context", context, "get", "namespaces", "-o", "json"}
+	if selector != "" {
+		arg = append(arg, "-l", selector)
+	}
+	out, err := kubectlOpts(false, false, arg...)
+	if err != nil {
+		return nil, err
+	}
+	return config.DecodeObjects([]byte(out))
+}
+
+// objects of all listable namespaced resources in the namespace, events
+// excluded, does not switch the current context
+func GetNamespacedObjects(context string, namespace string) ([]config.Object, error) {
+	out, err := kubectlOpts(false, false, "--context", context,
+		"api-resources", "--namespaced", "--verbs", "list", "-o", "name")
+	if err != nil {
+		return nil, err
+	}
+	var resources []string
+	for _, resource := range strings.Fields(out) {
+		if !transientResources[resource] {
+			resources = append(resources, resource)
+		}
+	}
+	out, err = kubectlOpts(false, false, "--context", context,
+		"get", strings.Join(resources, ","), "--namespace", namespace, "--ignore-not-found", "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+	return config.DecodeObjects([]byte(out))
 }
 
-func SetUpNamespaces(dirPath string) string {
-	return ApplyFile(dirPath + "/namespaces")
+// deletes the namespace with everything in it, does not switch the current context
+func DeleteNamespace(context string, name string) error {
+	_, err := kubectlOpts(true, false, "--context", context, "delete", "namespace", name, "--ignore-not-found")
+	return err
+}
+
+// the live object, nil if it does not exist, does not switch the current context
+func GetObject(context string, resource string, name string, namespace string) (*config.Object, error) {
+	arg := []string{"--context", context, "get", resource, name, "--ignore-not-found", "-o", "json"}
+	if namespace != "" {
+		arg = append(arg, "--namespace", namespace)
+	}
+	out, err := kubectlOpts(false, false, arg...)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := config.DecodeObjects([]byte(out))
+	if err != nil || len(objects) == 0 {
+		return nil, err
+	}
+	return &objects[0], nil
+}
+
+// waits for the rollout of the resource, e.g. deployment/rest-app, to complete,
+// does not switch the current context
+func RolloutStatus(context string, resource string, namespace string, timeout time.Duration) error {
+	// kubectl waits forever on a zero timeout
+	if timeout < time.Second {
+		timeout = time.Second
+	}
+	arg := []string{"--context", context, "rollout", "status", resource, "--timeout", timeout.String()}
+	if namespace != "" {
+		arg = append(arg, "--namespace", namespace)
+	}
+	_, err := kubectlOpts(true, false, arg...)
+	return err
+}
+
+// renders a kustomization directory, works without a cluster
+func Kustomize(dir string) ([]byte, error) {
+	result, err := kubectlOpts(false, false, "kustomize", dir)
+	return []byte(result), err
+}
+
+func SetContext(context string) (string, error) {
+	return kubectlOpts(true, false, "config", "use-context", context)
 }
 
 func SetUpCpolType(policiesPath string) string {
@@ -57,30 +199,11 @@ func RedeployPolicies(policiesPath string) {
 	ApplyDir(policiesPath + "/definitions")
 }
 
-// runs kubectl apply in dry run for legacy apps to get
-// the json representation of all the descriptors
-func GetLegacyDescriptorsAsJson(path string) string {
-	result, _ := kubectl(false, "apply", "-f", path, "-R", "-l", "cloud-legacy==supported", "-o", "json", "--dry-run=true")
-	return result
-}
-
-// runs kubectl apply in dry run for legacy apps to get
-// the json representation of all the descriptors
-func GetNonLegacyDescriptorsAsJson(path string) string {
-	result, _ := kubectl(false, "apply", "-f", path, "-R", "-l", "cloud-legacy!=supported", "-o", "json", "--dry-run=true")
-	return result
-}
-
 func GetAllCpol() string {
 	result, _ := kubectlStr(true, "get cpol -A")
 	return result
 }
 
-func ApplyFileToNamespace(file string, namespace string) string {
-	result, _ := kubectl(true, "apply", "-f", file, "--namespace="+namespace)
-	return result
-}
-
 func ApplyFile(file string) string {
 	result, _ := kubectl(true, "apply", "-f", file)
 	return result
@@ -101,44 +224,11 @@ func ApplyFileServerSide(file string) string {
 	return result
 }
 
-func DeleteCpol(name string, namespace string) string {
-	result, _ := kubectl(true, "delete", "cpol", name, "--namespace="+namespace)
-	return result
-}
-
 func DeleteAllCpols() string {
 	result, _ := kubectlOpts(true, false, "delete", "cpol", "--all")
 	return result
 }
 
-func GetCpolNameForNamespace(namespace string) string {
-	result, _ := kubectlStr(false, "get cpol -o jsonpath={.items[*].metadata.name} --namespace="+namespace)
-	return result
-}
-
-func GetCpolLabelsForNamespace(namespace string) []string {
-	result, _ := kubectlStr(false, "get cpol -o jsonpath={.items[*].spec.labels} --namespace="+namespace)
-	result = strings.Trim(result, "[]")
-	return strings.Split(result, " ")
-}
-
-func GetAllCloudGroupsFromCpols() []string {
-	result, _ := kubectlStr(false, "get cpol -A -o jsonpath={.items[*].metadata.labels.cloud-group}")
-	result = strings.Trim(result, "[]")
-	return strings.Split(result, " ")
-}
-
-func GetCpolLabelsForCloudGroup(cloudGroup string) []string {
-	result, _ := kubectlStr(false, "get cpol -A -o jsonpath={.items[*].spec.labels} -l cloud-group=="+cloudGroup)
-	result = strings.Trim(result, "[]")
-	return strings.Split(result, " ")
-}
-
-func GetCpolNamespaces() []string {
-	result, _ := kubectlStr(false, "get cpol -A -o jsonpath={.items[*].metadata.namespace}")
-	return strings.Split(result, " ")
-}
-
 func ShortVersion() string {
 	result, _ := kubectl(true, "version", "--short")
 	return result
@@ -153,7 +243,15 @@ func kubectl(logOutput bool, arg ...string) (string, error) {
 }
 
 func kubectlOpts(logOutput bool, failOnError bool, arg ...string) (string, error) {
+	return kubectlInput(logOutput, failOnError, nil, arg...)
+}
+
+// runs kubectl with the input passed on stdin, e.g. for -f -
+func kubectlInput(logOutput bool, failOnError bool, input []byte, arg ...string) (string, error) {
 	cmd := exec.Command("kubectl", arg...)
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
 	var outb, errb bytes.Buffer
 	cmd.Stdout = &outb
 	cmd.Stderr = &errb
@@ -161,6 +259,9 @@ func kubectlOpts(logOutput bool, failOnError bool, arg ...string) (string, error
 	if err != nil && failOnError {
 		log.Fatalf("Error starting process: %v\n Stderr: %s", err, errb.String())
 	}
+	if err != nil {
+		err = fmt.Errorf("kubectl %s: %v: %s", strings.Join(arg, " "), err, strings.TrimSpace(errb.String()))
+	}
 	outString := strings.Trim(outb.String(), "\n")
 	if logOutput {
 		util.SetDarkGray()
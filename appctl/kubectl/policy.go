@@ -0,0 +1,93 @@
+package kubectl
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/anliksim/bsc-deployer/config"
+	"github.com/anliksim/bsc-deployer/policy"
+)
+
+const groupLabel = "cloud-group"
+
+// fields of a cpol the deployer reads
+type cpolSpec struct {
+	Spec struct {
+		policy.Policy
+		// cloud-groups to deploy before the group of the cpol
+		DependsOn []string `json:"dependsOn"`
+	} `json:"spec"`
+}
+
+// builds a map of cloud-group -> cloud-groups it depends on
+// e.g. rest -> [monitoring rest-db]
+func GetGroupDependencies() (map[string][]string, error) {
+	cpols, err := GetCpols()
+	if err != nil {
+		return nil, err
+	}
+	return groupDependencies(cpols)
+}
+
+// builds a map of cloud-group -> placement policy of its cpols
+func GetGroupPolicies() (map[string]policy.Policy, error) {
+	cpols, err := GetCpols()
+	if err != nil {
+		return nil, err
+	}
+	return GroupPolicies(cpols)
+}
+
+// reads the cpols of all namespaces
+func GetCpols() ([]config.Object, error) {
+	out, err := kubectlOpts(false, false, "get", "cpol", "--all-namespaces", "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+	return config.DecodeObjects([]byte(out))
+}
+
+// builds a map of cloud-group -> policy merged from all cpols of the group
+func GroupPolicies(cpols []config.Object) (map[string]policy.Policy, error) {
+	policies := make(map[string][]policy.Policy)
+	for _, cpol := range cpols {
+		group := cpol.Labels[groupLabel]
+		if group == "" {
+			continue
+		}
+		spec, err := decodeSpec(cpol)
+		if err != nil {
+			return nil, err
+		}
+		policies[group] = append(policies[group], spec.Spec.Policy)
+	}
+	merged := make(map[string]policy.Policy)
+	for group, groupPolicies := range policies {
+		merged[group] = policy.Merge(groupPolicies...)
+	}
+	return merged, nil
+}
+
+func decodeSpec(cpol config.Object) (*cpolSpec, error) {
+	spec := new(cpolSpec)
+	if err := json.Unmarshal(cpol.Raw, spec); err != nil {
+		return nil, fmt.Errorf("error decoding cpol %s: %v", cpol.Name, err)
+	}
+	return spec, nil
+}
+
+// merges the dependencies of all cpols of a group
+func groupDependencies(cpols []config.Object) (map[string][]string, error) {
+	dependencies := make(map[string][]string)
+	for _, cpol := range cpols {
+		group := cpol.Labels[groupLabel]
+		if group == "" {
+			continue
+		}
+		spec, err := decodeSpec(cpol)
+		if err != nil {
+			return nil, err
+		}
+		dependencies[group] = append(dependencies[group], spec.Spec.DependsOn...)
+	}
+	return dependencies, nil
+}
@@ -0,0 +1,46 @@
+package kubectl
+
+import (
+	"github.com/anliksim/bsc-deployer/config"
+	"github.com/anliksim/bsc-deployer/policy"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const cpolsJson = `{"kind": "List", "items": [
+	{"kind": "CloudPolicy", "metadata": {"name": "rest", "labels": {"cloud-group": "rest"}},
+		"spec": {"labels": ["cloud-env-minikube"], "dependsOn": ["monitoring"]}},
+	{"kind": "CloudPolicy", "metadata": {"name": "rest-db", "namespace": "db", "labels": {"cloud-group": "rest"}},
+		"spec": {"dependsOn": ["rest-db"], "preferred": ["bsc-aks"], "maxClouds": 1, "residency": ["ch"]}},
+	{"kind": "CloudPolicy", "metadata": {"name": "monitoring", "labels": {"cloud-group": "monitoring"}},
+		"spec": {"labels": ["cloud-env-minikube"]}}
+]}`
+
+func TestGroupDependencies(t *testing.T) {
+	cpols, err := config.DecodeObjects([]byte(cpolsJson))
+	assert.NoError(t, err)
+
+	dependencies, err := groupDependencies(cpols)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"rest":       {"monitoring", "rest-db"},
+		"monitoring": nil,
+	}, dependencies)
+}
+
+func TestGroupPolicies(t *testing.T) {
+	cpols, err := config.DecodeObjects([]byte(cpolsJson))
+	assert.NoError(t, err)
+
+	policies, err := GroupPolicies(cpols)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]policy.Policy{
+		"rest": {
+			Labels:    []string{"cloud-env-minikube"},
+			Preferred: []string{"bsc-aks"},
+			MaxClouds: 1,
+			Residency: []string{"ch"},
+		},
+		"monitoring": {Labels: []string{"cloud-env-minikube"}},
+	}, policies)
+}
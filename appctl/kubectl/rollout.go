@@ -0,0 +1,134 @@
+package kubectl
+
+import (
+	"fmt"
+	"github.com/anliksim/bsc-deployer/config"
+	"log"
+	"strings"
+	"time"
+)
+
+// overrides the time to wait for the rollout of a workload, e.g. 10m
+const rolloutTimeoutAnnotation = "deployer/rollout-timeout"
+
+// resource types printed by kubectl apply mapped to the kinds with a rollout status
+var rolloutKinds = map[string]string{
+	"deployment":  "Deployment",
+	"statefulset": "StatefulSet",
+	"daemonset":   "DaemonSet",
+}
+
+// outcome of waiting for the rollout of a workload
+type Rollout struct {
+	Object config.Object
+	// nil if the rollout completed in time
+	Err error
+}
+
+func (r Rollout) Ready() bool {
+	return r.Err == nil
+}
+
+// workloads of the applied objects that kubectl apply
+// reported as created or configured in its output
+func changedWorkloads(output string, applied []config.Object) []config.Object {
+	var changed []config.Object
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[len(fields)-1] == "unchanged" {
+			continue
+		}
+		// e.g. deployment.apps/rest-app configured
+		resource := strings.SplitN(fields[0], "/", 2)
+		if len(resource) != 2 {
+			continue
+		}
+		kind, ok := rolloutKinds[strings.SplitN(resource[0], ".", 2)[0]]
+		if !ok {
+			continue
+		}
+		for _, object := range applied {
+			if object.Kind == kind && object.Name == resource[1] {
+				changed = append(changed, object)
+			}
+		}
+	}
+	return changed
+}
+
+// changed workloads whose generation the apply bumped, e.g. not the ones
+// that only got new deployer annotations, workloads missing before or
+// after the apply are kept
+func specChanged(changed []config.Object, before []config.Object, after []config.Object) []config.Object {
+	var result []config.Object
+	for _, workload := range changed {
+		previous, existed := findObject(before, workload)
+		current, exists := findObject(after, workload)
+		if existed && exists && previous.Generation == current.Generation {
+			continue
+		}
+		result = append(result, workload)
+	}
+	return result
+}
+
+// live object of the manifest, manifests without namespace match any namespace
+func findObject(live []config.Object, manifest config.Object) (config.Object, bool) {
+	for _, object := range live {
+		if object.Kind == manifest.Kind && object.Name == manifest.Name &&
+			(manifest.Namespace == "" || manifest.Namespace == object.Namespace) {
+			return object, true
+		}
+	}
+	return config.Object{}, false
+}
+
+// waits for the rollouts one after the other, each up to its own timeout
+func WaitForRollouts(context string, workloads []config.Object, defaultTimeout time.Duration) []Rollout {
+	rollouts := make([]Rollout, len(workloads))
+	for i, workload := range workloads {
+		timeout := rolloutTimeout(workload, defaultTimeout)
+		resource := strings.ToLower(workload.Kind) + "/" + workload.Name
+		log.Printf("Waiting up to %v for rollout of %s on %s...", timeout, resource, context)
+		rollouts[i] = Rollout{Object: workload}
+		if err := RolloutStatus(context, resource, workload.Namespace, timeout); err != nil {
+			rollouts[i].Err = fmt.Errorf("rollout of %s on %s not complete: %v", resource, context, err)
+		}
+	}
+	return rollouts
+}
+
+// timeout from the annotation, the progress deadline of deployments or the default
+func rolloutTimeout(workload config.Object, defaultTimeout time.Duration) time.Duration {
+	if value, ok := workload.Annotations[rolloutTimeoutAnnotation]; ok {
+		timeout, err := time.ParseDuration(value)
+		if err == nil && timeout > 0 {
+			return timeout
+		}
+		log.Printf("Ignoring invalid %s %q of %s", rolloutTimeoutAnnotation, value, workload.Name)
+	}
+	if workload.Kind == "Deployment" {
+		deployment, err := config.JsonToDeployment(workload.Raw)
+		if err != nil {
+			log.Printf("Ignoring progress deadline of %s: %v", workload.Name, err)
+			return defaultTimeout
+		}
+		if deadline := deployment.Spec.ProgressDeadlineSeconds; deadline != nil && *deadline > 0 {
+			return time.Duration(*deadline) * time.Second
+		}
+	}
+	return defaultTimeout
+}
+
+// objects of the kinds with a rollout status
+func Workloads(objects []config.Object) []config.Object {
+	var workloads []config.Object
+	for _, object := range objects {
+		for _, kind := range rolloutKinds {
+			if object.Kind == kind {
+				workloads = append(workloads, object)
+			}
+		}
+	}
+	return workloads
+}
@@ -0,0 +1,89 @@
+package kubectl
+
+import (
+	"github.com/anliksim/bsc-deployer/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const appliedYaml = `
+kind: Deployment
+metadata:
+  name: rest-app
+  namespace: rest
+spec:
+  progressDeadlineSeconds: 120
+---
+kind: StatefulSet
+metadata:
+  name: rest-db
+  namespace: rest
+  annotations:
+    deployer/rollout-timeout: 10m
+---
+kind: DaemonSet
+metadata:
+  name: log-agent
+---
+kind: Service
+metadata:
+  name: rest-app
+  namespace: rest
+`
+
+const applyOutput = `deployment.apps/rest-app configured
+statefulset.apps/rest-db created
+daemonset.apps/log-agent unchanged
+service/rest-app configured`
+
+func appliedObjects(t *testing.T) []config.Object {
+	objects, err := config.DecodeObjects([]byte(appliedYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return objects
+}
+
+func TestChangedWorkloads(t *testing.T) {
+	changed := changedWorkloads(applyOutput, appliedObjects(t))
+	if assert.Len(t, changed, 2) {
+		assert.Equal(t, "Deployment", changed[0].Kind)
+		assert.Equal(t, "rest-db", changed[1].Name)
+	}
+}
+
+func TestSpecChanged(t *testing.T) {
+	changed := appliedObjects(t)[:3]
+	before := []config.Object{
+		{Kind: "Deployment", Name: "rest-app", Namespace: "rest", Generation: 3},
+		{Kind: "DaemonSet", Name: "log-agent", Namespace: "default", Generation: 1},
+	}
+	after := []config.Object{
+		{Kind: "Deployment", Name: "rest-app", Namespace: "rest", Generation: 3},
+		{Kind: "StatefulSet", Name: "rest-db", Namespace: "rest", Generation: 1},
+		{Kind: "DaemonSet", Name: "log-agent", Namespace: "default", Generation: 2},
+	}
+
+	// rest-app only got new annotations, rest-db was created
+	assert.Equal(t, []string{"rest-db", "log-agent"}, objectNames(specChanged(changed, before, after)))
+}
+
+func objectNames(objects []config.Object) []string {
+	var names []string
+	for _, object := range objects {
+		names = append(names, object.Name)
+	}
+	return names
+}
+
+func TestChangedWorkloads_Empty(t *testing.T) {
+	assert.Empty(t, changedWorkloads("", appliedObjects(t)))
+}
+
+func TestRolloutTimeout(t *testing.T) {
+	objects := appliedObjects(t)
+	assert.Equal(t, 2*time.Minute, rolloutTimeout(objects[0], time.Minute))
+	assert.Equal(t, 10*time.Minute, rolloutTimeout(objects[1], time.Minute))
+	assert.Equal(t, time.Minute, rolloutTimeout(objects[2], time.Minute))
+}
@@ -0,0 +1,189 @@
+package legacyctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+const DefaultTimeout = 30 * time.Second
+const DefaultRetries = 3
+
+const StatusStarting = "starting"
+const StatusRunning = "running"
+const StatusFailed = "failed"
+const StatusStopped = "stopped"
+
+// process as reported by a legacy host, see openapi.yaml
+type Process struct {
+	Name   string            `json:"name"`
+	Status string            `json:"status"`
+	Pid    int               `json:"pid,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// config files as reported by a legacy host, see openapi.yaml
+type ConfigFiles struct {
+	Name   string            `json:"name"`
+	Files  []string          `json:"files"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// error returned if a legacy host responded with a non 2xx status
+type StatusError struct {
+	Url        string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s responded with %d: %s", e.Url, e.StatusCode, e.Body)
+}
+
+// http client for the process api of legacy hosts
+type Client struct {
+	http         *http.Client
+	retries      int
+	backoff      time.Duration
+	pollInterval time.Duration
+}
+
+func NewClient(timeout time.Duration, retries int) *Client {
+	return &Client{
+		http:         &http.Client{Timeout: timeout},
+		retries:      retries,
+		backoff:      500 * time.Millisecond,
+		pollInterval: 2 * time.Second,
+	}
+}
+
+func (c *Client) PostProcess(host string, payload []byte) (*Process, error) {
+	process := new(Process)
+	err := c.do(http.MethodPost, serverUrl(host, "processes"), payload, process)
+	return process, err
+}
+
+func (c *Client) GetProcess(host string, name string) (*Process, error) {
+	process := new(Process)
+	err := c.do(http.MethodGet, serverUrl(host, fmt.Sprintf("processes/%s", name)), nil, process)
+	return process, err
+}
+
+func (c *Client) ListProcesses(host string) ([]Process, error) {
+	var processes []Process
+	err := c.do(http.MethodGet, serverUrl(host, "processes"), nil, &processes)
+	return processes, err
+}
+
+func (c *Client) DeleteProcess(host string, name string) (*Process, error) {
+	process := new(Process)
+	err := c.do(http.MethodDelete, serverUrl(host, fmt.Sprintf("processes/%s", name)), nil, process)
+	return process, err
+}
+
+func (c *Client) PostConfig(host string, payload []byte) (*ConfigFiles, error) {
+	configFiles := new(ConfigFiles)
+	err := c.do(http.MethodPost, serverUrl(host, "configs"), payload, configFiles)
+	return configFiles, err
+}
+
+func (c *Client) ListConfigs(host string) ([]ConfigFiles, error) {
+	var configs []ConfigFiles
+	err := c.do(http.MethodGet, serverUrl(host, "configs"), nil, &configs)
+	return configs, err
+}
+
+func (c *Client) DeleteConfig(host string, name string) (*ConfigFiles, error) {
+	configFiles := new(ConfigFiles)
+	err := c.do(http.MethodDelete, serverUrl(host, fmt.Sprintf("configs/%s", name)), nil, configFiles)
+	return configFiles, err
+}
+
+// polls the process until it is running, fails early if
+// the process failed or stopped and gives up after timeout
+func (c *Client) WaitForRunning(host string, name string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		process, err := c.GetProcess(host, name)
+		if err == nil {
+			switch process.Status {
+			case StatusRunning:
+				return nil
+			case StatusFailed, StatusStopped:
+				return fmt.Errorf("process %s is %s", name, process.Status)
+			}
+			err = fmt.Errorf("process %s is %s", name, process.Status)
+		}
+		if time.Now().Add(c.pollInterval).After(deadline) {
+			return fmt.Errorf("not running after %v: %v", timeout, err)
+		}
+		time.Sleep(c.pollInterval)
+	}
+}
+
+// runs the request and decodes the response into v, connection errors and 5xx responses
+// are retried with exponential backoff, POSTs only if they never reached the host as
+// they would e.g. start a process twice
+func (c *Client) do(method string, url string, payload []byte, v interface{}) error {
+	var err error
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(c.backoff * time.Duration(1<<uint(attempt-1)))
+		}
+		var retry bool
+		if retry, err = c.doOnce(method, url, payload, v); err == nil || !retry {
+			return err
+		}
+		log.Printf("Attempt %d of %s %s failed: %v", attempt+1, method, url, err)
+	}
+	return err
+}
+
+func (c *Client) doOnce(method string, url string, payload []byte, v interface{}) (bool, error) {
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(payload))
+	if err != nil {
+		return false, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return idempotent(method) || notSent(err), err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return idempotent(method), err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return idempotent(method) && resp.StatusCode >= 500, &StatusError{Url: url, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	if len(body) == 0 || v == nil {
+		return false, nil
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return false, fmt.Errorf("invalid response from %s: %v", url, err)
+	}
+	return false, nil
+}
+
+func idempotent(method string) bool {
+	return method == http.MethodGet || method == http.MethodDelete
+}
+
+// whether the request failed while connecting, before anything was sent
+func notSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func serverUrl(host string, path string) string {
+	return fmt.Sprintf("%s/%s", host, path)
+}
@@ -0,0 +1,73 @@
+package legacyctl
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testClient() *Client {
+	client := NewClient(time.Second, 2)
+	client.backoff = time.Millisecond
+	return client
+}
+
+func TestGetProcess_RetriesOnServerError(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"name":"rest-app","status":"running","pid":42}`))
+	}))
+	defer server.Close()
+
+	process, err := testClient().GetProcess(server.URL, "rest-app")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, "rest-app", process.Name)
+	assert.Equal(t, "running", process.Status)
+	assert.Equal(t, 42, process.Pid)
+}
+
+func TestPostProcess_NoRetryOnServerError(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := testClient().PostProcess(server.URL, []byte(`{}`))
+	assert.Equal(t, 1, calls)
+	if assert.IsType(t, &StatusError{}, err) {
+		assert.Equal(t, http.StatusServiceUnavailable, err.(*StatusError).StatusCode)
+	}
+}
+
+func TestDeleteProcess_NoRetryOnClientError(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Equal(t, http.MethodDelete, r.Method)
+		assert.Equal(t, "/processes/rest-app", r.URL.Path)
+		http.Error(w, "unknown process", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := testClient().DeleteProcess(server.URL, "rest-app")
+	assert.Equal(t, 1, calls)
+	if assert.IsType(t, &StatusError{}, err) {
+		assert.Equal(t, http.StatusNotFound, err.(*StatusError).StatusCode)
+	}
+}
+
+func TestPostProcess_ConnectionError(t *testing.T) {
+	_, err := testClient().PostProcess("http://127.0.0.1:1", []byte(`{}`))
+	assert.Error(t, err)
+	assert.True(t, notSent(err))
+}
@@ -1,104 +1,182 @@
 package legacyctl
 
 import (
-	"bytes"
 	"fmt"
-	"github.com/anliksim/bsc-deployer/appctl/kubectl"
 	"github.com/anliksim/bsc-deployer/config"
 	"github.com/anliksim/bsc-deployer/util"
-	"io/ioutil"
+	v1 "k8s.io/api/core/v1"
 	"log"
-	"net/http"
-	"strings"
+	"time"
 )
 
-func appsPath(dirPath string) string {
-	return dirPath + "/apps"
-}
+const defaultReadyTimeout = 30 * time.Second
+const legacySelector = "cloud-legacy==supported"
+
+// target to load manifests for, selects overlays, values and variables
+const Target = "legacy"
+
+// kubernetes defaults for readiness probes
+const defaultPeriodSeconds = 10
+const defaultFailureThreshold = 3
 
-func Apply(dirPath string) {
-	jsonString := kubectl.GetLegacyDescriptorsAsJson(appsPath(dirPath))
-	// multiple Deployments are returned as part of kind List by kubectl
-	if strings.Contains(jsonString, "List") {
-		config.ForEachItemInList([]byte(jsonString), func(payload []byte) {
-			runDeployment(payload)
-		})
-	} else {
-		runDeployment([]byte(jsonString))
+// deploys the manifests labelled for legacy, which
+// must have been loaded for Target
+func Apply(client *Client, manifests []config.Object, pools map[string][]string) []error {
+	var errs []error
+	descriptors, err := legacyDescriptors(manifests)
+	if err != nil {
+		return appendError(errs, err)
+	}
+	for _, descriptor := range descriptors {
+		errs = append(errs, runDeployment(client, descriptor, pools)...)
 	}
+	return errs
 }
 
-func Delete(dirPath string) {
-	jsonString := kubectl.GetLegacyDescriptorsAsJson(appsPath(dirPath))
-	// multiple Deployments are returned as part of kind List by kubectl
-	if strings.Contains(jsonString, "List") {
-		config.ForEachItemInList([]byte(jsonString), func(payload []byte) {
-			runStop(payload)
-		})
-	} else {
-		runStop([]byte(jsonString))
+func Delete(client *Client, manifests []config.Object, pools map[string][]string) []error {
+	var errs []error
+	descriptors, err := legacyDescriptors(manifests)
+	if err != nil {
+		return appendError(errs, err)
 	}
+	for _, descriptor := range descriptors {
+		errs = append(errs, runStop(client, descriptor, pools)...)
+	}
+	return errs
 }
 
-func runStop(payload []byte) {
-	deployment := config.JsonToDeployment(payload)
-	name := deployment.Name
-	host := deployment.Spec.Template.Annotations["legacy/host"]
-	log.Printf("Deleting apps from %s...", host)
-	deleteProcess(host, name)
+func legacyDescriptors(manifests []config.Object) ([]config.Object, error) {
+	return config.SelectObjects(manifests, legacySelector)
 }
 
-func runDeployment(payload []byte) {
-	deployment := config.JsonToDeployment(payload)
-	host := deployment.Spec.Template.Annotations["legacy/host"]
-	log.Printf("Deploying to %s...", host)
-	postProcesses(host, payload)
+func runStop(client *Client, descriptor config.Object, pools map[string][]string) []error {
+	var errs []error
+	w, instances, err := workloadInstances(descriptor, pools)
+	if err != nil {
+		return appendError(errs, err)
+	}
+	for _, i := range instances {
+		log.Printf("Deleting %s %s from %s...", w.kind, i.name, i.host)
+		errs = appendError(errs, stopInstance(client, w, i))
+	}
+	return errs
 }
 
-func postProcesses(host string, payload []byte) {
-	call(func() (response *http.Response, e error) {
-		return http.Post(serverUrl(host, "processes"), "application/json", bytes.NewBuffer(payload))
-	}, func(body []byte) {
-		printResponse(body)
-	})
+func stopInstance(client *Client, w *workload, i instance) error {
+	if w.config {
+		configFiles, err := client.DeleteConfig(i.host, i.name)
+		if err != nil {
+			return fmt.Errorf("failed to delete %s from %s: %v", i.name, i.host, err)
+		}
+		printConfig(configFiles)
+		return nil
+	}
+	process, err := client.DeleteProcess(i.host, i.name)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s from %s: %v", i.name, i.host, err)
+	}
+	printProcess(process)
+	return nil
 }
 
-func deleteProcess(host string, name string) {
-	call(func() (response *http.Response, e error) {
-		req, err := http.NewRequest(http.MethodDelete, serverUrl(host, fmt.Sprintf("processes/%s", name)), nil)
-		if err != nil {
-			log.Fatalf("Error on delete: %v", err)
+// rolls out the instances in batches of maxUnavailable, waiting for each
+// batch to be running before the next, a failed batch stops the rollout
+func runDeployment(client *Client, descriptor config.Object, pools map[string][]string) []error {
+	var errs []error
+	w, instances, err := workloadInstances(descriptor, pools)
+	if err != nil {
+		return appendError(errs, err)
+	}
+	for _, batch := range batches(instances, w.maxUnavailable) {
+		for _, i := range batch {
+			log.Printf("Deploying %s %s to %s...", w.kind, i.name, i.host)
+			errs = appendError(errs, postInstance(client, w, i))
+		}
+		if w.awaitRunning {
+			for _, i := range batch {
+				log.Printf("Waiting up to %v for %s to be running...", w.readyTimeout, i.name)
+				if err := client.WaitForRunning(i.host, i.name, w.readyTimeout); err != nil {
+					errs = appendError(errs, fmt.Errorf("failed to deploy %s to %s: %v", i.name, i.host, err))
+				}
+			}
+		}
+		if len(errs) > 0 {
+			return appendError(errs, fmt.Errorf("stopped rollout of %s %s", w.kind, w.name))
 		}
-		return http.DefaultClient.Do(req)
-	}, func(body []byte) {
-		printResponse(body)
-	})
+	}
+	return errs
 }
 
-func printResponse(body []byte) {
-	util.SetDarkGray()
-	fmt.Printf("%s\n", body)
-	util.SetNoColor()
+func postInstance(client *Client, w *workload, i instance) error {
+	if w.config {
+		configFiles, err := client.PostConfig(i.host, i.payload)
+		if err != nil {
+			return fmt.Errorf("failed to deploy %s to %s: %v", i.name, i.host, err)
+		}
+		printConfig(configFiles)
+		return nil
+	}
+	process, err := client.PostProcess(i.host, i.payload)
+	if err != nil {
+		return fmt.Errorf("failed to deploy %s to %s: %v", i.name, i.host, err)
+	}
+	printProcess(process)
+	return nil
 }
 
-func call(httpCall func() (*http.Response, error), callback func([]byte)) {
-	resp, err := httpCall()
+func workloadInstances(descriptor config.Object, pools map[string][]string) (*workload, []instance, error) {
+	w, err := toWorkload(descriptor, pools)
 	if err != nil {
-		log.Printf("Error on get: %v", err)
+		return nil, nil, err
 	}
-	handle(resp, callback)
+	instances, err := w.instances()
+	return w, instances, err
 }
 
-func handle(resp *http.Response, callback func([]byte)) {
-	if resp != nil {
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			log.Fatalf("Error parsing response: %v", err)
+// derives the time to wait for a process from the readiness probes
+// of its containers, i.e. the time after which kubelet would give up
+func readyTimeout(template *v1.PodTemplateSpec) time.Duration {
+	var timeout time.Duration
+	for _, container := range template.Spec.Containers {
+		probe := container.ReadinessProbe
+		if probe == nil {
+			continue
+		}
+		period := probe.PeriodSeconds
+		if period == 0 {
+			period = defaultPeriodSeconds
+		}
+		threshold := probe.FailureThreshold
+		if threshold == 0 {
+			threshold = defaultFailureThreshold
 		}
-		callback(body)
+		probeTimeout := time.Duration(probe.InitialDelaySeconds+period*threshold) * time.Second
+		if probeTimeout > timeout {
+			timeout = probeTimeout
+		}
+	}
+	if timeout == 0 {
+		return defaultReadyTimeout
 	}
+	return timeout
 }
 
-func serverUrl(host string, path string) string {
-	return fmt.Sprintf("%s/%s", host, path)
+func printProcess(process *Process) {
+	util.SetDarkGray()
+	fmt.Printf("%s %s\n", process.Name, process.Status)
+	util.SetNoColor()
+}
+
+func printConfig(configFiles *ConfigFiles) {
+	util.SetDarkGray()
+	fmt.Printf("%s %v\n", configFiles.Name, configFiles.Files)
+	util.SetNoColor()
+}
+
+func appendError(errs []error, err error) []error {
+	if err != nil {
+		log.Print(err)
+		return append(errs, err)
+	}
+	return errs
 }
@@ -0,0 +1,31 @@
+package legacyctl
+
+import (
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"testing"
+	"time"
+)
+
+func templateWithProbes(probes ...*v1.Probe) *v1.PodTemplateSpec {
+	template := new(v1.PodTemplateSpec)
+	for _, probe := range probes {
+		template.Spec.Containers = append(template.Spec.Containers, v1.Container{ReadinessProbe: probe})
+	}
+	return template
+}
+
+func TestReadyTimeout_Default(t *testing.T) {
+	assert.Equal(t, defaultReadyTimeout, readyTimeout(templateWithProbes(nil)))
+}
+
+func TestReadyTimeout_ProbeDefaults(t *testing.T) {
+	probe := &v1.Probe{InitialDelaySeconds: 15}
+	assert.Equal(t, 45*time.Second, readyTimeout(templateWithProbes(probe)))
+}
+
+func TestReadyTimeout_SlowestContainer(t *testing.T) {
+	fast := &v1.Probe{PeriodSeconds: 1, FailureThreshold: 5}
+	slow := &v1.Probe{InitialDelaySeconds: 60, PeriodSeconds: 5, FailureThreshold: 2}
+	assert.Equal(t, 70*time.Second, readyTimeout(templateWithProbes(fast, slow)))
+}
@@ -0,0 +1,170 @@
+package legacyctl
+
+import (
+	"fmt"
+	"github.com/anliksim/bsc-deployer/config"
+	"log"
+	"sort"
+)
+
+// label marking processes and configs deployed from the env repo
+const legacyLabel = "cloud-legacy"
+
+// names of the processes and configs expected on a host
+type desiredState struct {
+	processes map[string]bool
+	configs   map[string]bool
+}
+
+func newDesiredState() *desiredState {
+	return &desiredState{
+		processes: make(map[string]bool),
+		configs:   make(map[string]bool),
+	}
+}
+
+// stops processes and removes configs on the known hosts, the pool hosts
+// and the hosts referenced by the current descriptors that are no longer
+// part of the env repo, only entries carrying the cloud-legacy label are
+// considered, this also removes replicas after scaling down
+func Prune(client *Client, manifests []config.Object, pools map[string][]string, knownHosts []string) []error {
+	desired, err := desiredStates(manifests, pools, knownHosts)
+	if err != nil {
+		return []error{err}
+	}
+	return pruneHosts(client, desired)
+}
+
+// number of processes and configs Prune would remove, e.g. to guard deletions
+func CountOrphans(client *Client, manifests []config.Object, pools map[string][]string, knownHosts []string) (int, error) {
+	desired, err := desiredStates(manifests, pools, knownHosts)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, host := range sortedHosts(desired) {
+		processes, err := client.ListProcesses(host)
+		if err != nil {
+			return 0, fmt.Errorf("failed to list processes on %s: %v", host, err)
+		}
+		for _, process := range processes {
+			if isOrphan(process.Name, process.Labels, desired[host].processes) {
+				count++
+			}
+		}
+		configs, err := client.ListConfigs(host)
+		if err != nil {
+			return 0, fmt.Errorf("failed to list configs on %s: %v", host, err)
+		}
+		for _, configFiles := range configs {
+			if isOrphan(configFiles.Name, configFiles.Labels, desired[host].configs) {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+// processes and configs expected per host, fails rather than
+// returning an incomplete desired state
+func desiredStates(manifests []config.Object, pools map[string][]string, knownHosts []string) (map[string]*desiredState, error) {
+	desired := make(map[string]*desiredState)
+	for _, host := range knownHosts {
+		desired[host] = newDesiredState()
+	}
+	for _, hosts := range pools {
+		for _, host := range hosts {
+			desired[host] = newDesiredState()
+		}
+	}
+	descriptors, err := legacyDescriptors(manifests)
+	if err != nil {
+		// never prune based on an incomplete desired state
+		return nil, err
+	}
+	for _, descriptor := range descriptors {
+		w, instances, err := workloadInstances(descriptor, pools)
+		if err != nil {
+			// the instances of the descriptor would be stopped as orphans
+			return nil, fmt.Errorf("not pruning legacy hosts: %v", err)
+		}
+		for _, i := range instances {
+			if desired[i.host] == nil {
+				desired[i.host] = newDesiredState()
+			}
+			if w.config {
+				desired[i.host].configs[i.name] = true
+			} else {
+				desired[i.host].processes[i.name] = true
+			}
+		}
+	}
+	return desired, nil
+}
+
+func pruneHosts(client *Client, desired map[string]*desiredState) []error {
+	var errs []error
+	for _, host := range sortedHosts(desired) {
+		errs = append(errs, pruneProcesses(client, host, desired[host].processes)...)
+		errs = append(errs, pruneConfigs(client, host, desired[host].configs)...)
+	}
+	return errs
+}
+
+func pruneProcesses(client *Client, host string, desired map[string]bool) []error {
+	var errs []error
+	processes, err := client.ListProcesses(host)
+	if err != nil {
+		return appendError(errs, fmt.Errorf("failed to list processes on %s: %v", host, err))
+	}
+	for _, process := range processes {
+		if !isOrphan(process.Name, process.Labels, desired) {
+			continue
+		}
+		log.Printf("Stopping orphaned process %s on %s...", process.Name, host)
+		stopped, err := client.DeleteProcess(host, process.Name)
+		if err != nil {
+			errs = appendError(errs, fmt.Errorf("failed to prune %s from %s: %v", process.Name, host, err))
+			continue
+		}
+		printProcess(stopped)
+	}
+	return errs
+}
+
+func pruneConfigs(client *Client, host string, desired map[string]bool) []error {
+	var errs []error
+	configs, err := client.ListConfigs(host)
+	if err != nil {
+		return appendError(errs, fmt.Errorf("failed to list configs on %s: %v", host, err))
+	}
+	for _, configFiles := range configs {
+		if !isOrphan(configFiles.Name, configFiles.Labels, desired) {
+			continue
+		}
+		log.Printf("Removing orphaned config %s on %s...", configFiles.Name, host)
+		removed, err := client.DeleteConfig(host, configFiles.Name)
+		if err != nil {
+			errs = appendError(errs, fmt.Errorf("failed to prune %s from %s: %v", configFiles.Name, host, err))
+			continue
+		}
+		printConfig(removed)
+	}
+	return errs
+}
+
+func isOrphan(name string, labels map[string]string, desired map[string]bool) bool {
+	_, managed := labels[legacyLabel]
+	return managed && !desired[name]
+}
+
+func sortedHosts(desired map[string]*desiredState) []string {
+	hosts := make([]string, 0, len(desired))
+	for host := range desired {
+		if host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
@@ -0,0 +1,87 @@
+package legacyctl
+
+import (
+	"github.com/anliksim/bsc-deployer/config"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+)
+
+const unmanagedDescriptor = `{
+	"kind": "Deployment",
+	"metadata": {"name": "ops-agent"}
+}`
+
+const orphanDescriptor = `{
+	"kind": "Deployment",
+	"metadata": {
+		"name": "old-app",
+		"labels": {"cloud-legacy": "supported"}
+	}
+}`
+
+func TestPruneHosts_StopsManagedOrphansOnly(t *testing.T) {
+	server := httptest.NewServer(NewStubServer())
+	defer server.Close()
+	client := testClient()
+	for _, descriptor := range []string{testDescriptor, unmanagedDescriptor, orphanDescriptor} {
+		_, err := client.PostProcess(server.URL, []byte(descriptor))
+		assert.NoError(t, err)
+	}
+
+	desired := newDesiredState()
+	desired.processes["rest-app"] = true
+	errs := pruneHosts(client, map[string]*desiredState{server.URL: desired})
+	assert.Empty(t, errs)
+
+	processes, err := client.ListProcesses(server.URL)
+	assert.NoError(t, err)
+	var names []string
+	for _, p := range processes {
+		names = append(names, p.Name)
+	}
+	assert.Equal(t, []string{"ops-agent", "rest-app"}, names)
+}
+
+func TestPruneHosts_UnreachableHost(t *testing.T) {
+	client := testClient()
+	errs := pruneHosts(client, map[string]*desiredState{"http://127.0.0.1:1": newDesiredState()})
+	assert.Len(t, errs, 2)
+}
+
+func TestCountOrphans(t *testing.T) {
+	server := httptest.NewServer(NewStubServer())
+	defer server.Close()
+	client := testClient()
+	for _, descriptor := range []string{unmanagedDescriptor, orphanDescriptor} {
+		_, err := client.PostProcess(server.URL, []byte(descriptor))
+		assert.NoError(t, err)
+	}
+
+	count, err := CountOrphans(client, nil, nil, []string{server.URL})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	// nothing stopped
+	processes, err := client.ListProcesses(server.URL)
+	assert.NoError(t, err)
+	assert.Len(t, processes, 2)
+}
+
+func TestPrune_SkipsIncompleteDesiredState(t *testing.T) {
+	server := httptest.NewServer(NewStubServer())
+	defer server.Close()
+	client := testClient()
+	_, err := client.PostProcess(server.URL, []byte(orphanDescriptor))
+	assert.NoError(t, err)
+	descriptor := decodeDescriptor(t, `{
+		"kind": "Deployment",
+		"metadata": {"name": "old-app", "labels": {"cloud-legacy": "supported"}},
+		"spec": {"template": {"metadata": {"annotations": {"legacy/host-pool": "unknown"}}}}
+	}`)
+
+	errs := Prune(client, []config.Object{descriptor}, nil, []string{server.URL})
+	assert.Len(t, errs, 1)
+	processes, err := client.ListProcesses(server.URL)
+	assert.NoError(t, err)
+	assert.Len(t, processes, 1)
+}
@@ -0,0 +1,208 @@
+package legacyctl
+
+import (
+	"encoding/json"
+	"github.com/anliksim/bsc-deployer/util"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// in-memory implementation of the legacy process api described
+// in openapi.yaml, used by tests and for local development
+type StubServer struct {
+	// time a process reports starting before it is running
+	StartupDelay time.Duration
+	router       *mux.Router
+	lock         sync.Mutex
+	processes    map[string]*Process
+	configs      map[string]*ConfigFiles
+	started      map[string]time.Time
+	lastPid      int
+}
+
+func NewStubServer() *StubServer {
+	s := &StubServer{
+		router:    mux.NewRouter(),
+		processes: make(map[string]*Process),
+		configs:   make(map[string]*ConfigFiles),
+		started:   make(map[string]time.Time),
+		lastPid:   1000,
+	}
+	s.router.HandleFunc("/processes", s.listProcesses).Methods("GET")
+	s.router.HandleFunc("/processes", s.postProcess).Methods("POST")
+	s.router.HandleFunc("/processes/{name}", s.getProcess).Methods("GET")
+	s.router.HandleFunc("/processes/{name}", s.deleteProcess).Methods("DELETE")
+	s.router.HandleFunc("/configs", s.listConfigs).Methods("GET")
+	s.router.HandleFunc("/configs", s.postConfig).Methods("POST")
+	s.router.HandleFunc("/configs/{name}", s.deleteConfig).Methods("DELETE")
+	return s
+}
+
+func (s *StubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+type descriptor struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
+	} `json:"metadata"`
+	// set for ConfigMaps only
+	Data       map[string]string `json:"data"`
+	BinaryData map[string][]byte `json:"binaryData"`
+}
+
+func readDescriptor(w http.ResponseWriter, r *http.Request) (*descriptor, bool) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	d := new(descriptor)
+	if err := json.Unmarshal(body, d); err != nil {
+		http.Error(w, "invalid descriptor: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if d.Kind == "" || d.Metadata.Name == "" {
+		http.Error(w, "descriptor requires kind and metadata.name", http.StatusBadRequest)
+		return nil, false
+	}
+	return d, true
+}
+
+func (s *StubServer) listProcesses(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	processes := make([]Process, 0, len(s.processes))
+	for _, p := range s.processes {
+		processes = append(processes, s.withStatus(p))
+	}
+	sort.Slice(processes, func(i, j int) bool {
+		return processes[i].Name < processes[j].Name
+	})
+	util.RespondJson(w, processes)
+}
+
+func (s *StubServer) postProcess(w http.ResponseWriter, r *http.Request) {
+	d, ok := readDescriptor(w, r)
+	if !ok {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, exists := s.processes[d.Metadata.Name]
+	s.lastPid++
+	process := &Process{
+		Name:   d.Metadata.Name,
+		Pid:    s.lastPid,
+		Labels: d.Metadata.Labels,
+	}
+	s.processes[process.Name] = process
+	s.started[process.Name] = time.Now()
+	if !exists {
+		w.WriteHeader(http.StatusCreated)
+	}
+	util.RespondJson(w, s.withStatus(process))
+}
+
+func (s *StubServer) getProcess(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	process, ok := s.processes[mux.Vars(r)["name"]]
+	if !ok {
+		http.Error(w, "unknown process", http.StatusNotFound)
+		return
+	}
+	util.RespondJson(w, s.withStatus(process))
+}
+
+func (s *StubServer) deleteProcess(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	name := mux.Vars(r)["name"]
+	process, ok := s.processes[name]
+	if !ok {
+		http.Error(w, "unknown process", http.StatusNotFound)
+		return
+	}
+	delete(s.processes, name)
+	delete(s.started, name)
+	stopped := *process
+	stopped.Status = StatusStopped
+	util.RespondJson(w, stopped)
+}
+
+// copy of the process with the status derived from its start time
+func (s *StubServer) withStatus(process *Process) Process {
+	p := *process
+	p.Status = StatusRunning
+	if time.Since(s.started[p.Name]) < s.StartupDelay {
+		p.Status = StatusStarting
+	}
+	return p
+}
+
+func (s *StubServer) listConfigs(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	configs := make([]ConfigFiles, 0, len(s.configs))
+	for _, c := range s.configs {
+		configs = append(configs, *c)
+	}
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].Name < configs[j].Name
+	})
+	util.RespondJson(w, configs)
+}
+
+func (s *StubServer) postConfig(w http.ResponseWriter, r *http.Request) {
+	d, ok := readDescriptor(w, r)
+	if !ok {
+		return
+	}
+	if d.Kind != "ConfigMap" {
+		http.Error(w, "configs require kind ConfigMap", http.StatusBadRequest)
+		return
+	}
+	files := make([]string, 0, len(d.Data)+len(d.BinaryData))
+	for file := range d.Data {
+		files = append(files, file)
+	}
+	for file := range d.BinaryData {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, exists := s.configs[d.Metadata.Name]
+	configFiles := &ConfigFiles{
+		Name:   d.Metadata.Name,
+		Files:  files,
+		Labels: d.Metadata.Labels,
+	}
+	s.configs[configFiles.Name] = configFiles
+	if !exists {
+		w.WriteHeader(http.StatusCreated)
+	}
+	util.RespondJson(w, configFiles)
+}
+
+func (s *StubServer) deleteConfig(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	name := mux.Vars(r)["name"]
+	configFiles, ok := s.configs[name]
+	if !ok {
+		http.Error(w, "unknown config", http.StatusNotFound)
+		return
+	}
+	delete(s.configs, name)
+	util.RespondJson(w, configFiles)
+}
@@ -0,0 +1,90 @@
+package legacyctl
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testDescriptor = `{
+	"apiVersion": "apps/v1",
+	"kind": "Deployment",
+	"metadata": {
+		"name": "rest-app",
+		"labels": {"cloud-legacy": "supported"}
+	}
+}`
+
+func TestStubServer_Lifecycle(t *testing.T) {
+	server := httptest.NewServer(NewStubServer())
+	defer server.Close()
+	client := testClient()
+
+	process, err := client.PostProcess(server.URL, []byte(testDescriptor))
+	assert.NoError(t, err)
+	assert.Equal(t, "rest-app", process.Name)
+	assert.Equal(t, StatusRunning, process.Status)
+	assert.Equal(t, "supported", process.Labels["cloud-legacy"])
+
+	process, err = client.GetProcess(server.URL, "rest-app")
+	assert.NoError(t, err)
+	assert.Equal(t, StatusRunning, process.Status)
+
+	processes, err := client.ListProcesses(server.URL)
+	assert.NoError(t, err)
+	assert.Len(t, processes, 1)
+
+	process, err = client.DeleteProcess(server.URL, "rest-app")
+	assert.NoError(t, err)
+	assert.Equal(t, StatusStopped, process.Status)
+
+	_, err = client.GetProcess(server.URL, "rest-app")
+	assert.IsType(t, &StatusError{}, err)
+}
+
+func TestStubServer_RejectsInvalidDescriptor(t *testing.T) {
+	server := httptest.NewServer(NewStubServer())
+	defer server.Close()
+
+	_, err := testClient().PostProcess(server.URL, []byte(`{"metadata": {}}`))
+	if assert.IsType(t, &StatusError{}, err) {
+		assert.Equal(t, 400, err.(*StatusError).StatusCode)
+	}
+}
+
+func TestWaitForRunning_Starting(t *testing.T) {
+	stub := NewStubServer()
+	stub.StartupDelay = 50 * time.Millisecond
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	client := testClient()
+	client.pollInterval = 10 * time.Millisecond
+
+	process, err := client.PostProcess(server.URL, []byte(testDescriptor))
+	assert.NoError(t, err)
+	assert.Equal(t, StatusStarting, process.Status)
+	assert.NoError(t, client.WaitForRunning(server.URL, "rest-app", time.Second))
+}
+
+func TestWaitForRunning_Timeout(t *testing.T) {
+	stub := NewStubServer()
+	stub.StartupDelay = time.Minute
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	client := testClient()
+	client.pollInterval = 10 * time.Millisecond
+
+	_, err := client.PostProcess(server.URL, []byte(testDescriptor))
+	assert.NoError(t, err)
+	assert.Error(t, client.WaitForRunning(server.URL, "rest-app", 50*time.Millisecond))
+}
+
+func TestWaitForRunning_UnknownProcess(t *testing.T) {
+	server := httptest.NewServer(NewStubServer())
+	defer server.Close()
+	client := testClient()
+	client.pollInterval = 10 * time.Millisecond
+
+	assert.Error(t, client.WaitForRunning(server.URL, "rest-app", 50*time.Millisecond))
+}
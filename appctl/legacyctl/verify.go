@@ -0,0 +1,45 @@
+package legacyctl
+
+import (
+	"fmt"
+	"github.com/anliksim/bsc-deployer/config"
+	"time"
+)
+
+const groupLabel = "cloud-group"
+
+// checks that the processes of the legacy descriptors are running, waiting
+// for them until the deadline, returns the errors per cloud-group
+func Verify(client *Client, manifests []config.Object, pools map[string][]string, deadline time.Time) map[string][]error {
+	failed := make(map[string][]error)
+	descriptors, err := legacyDescriptors(manifests)
+	if err != nil {
+		failed[""] = appendError(nil, err)
+		return failed
+	}
+	for _, descriptor := range descriptors {
+		group := descriptor.Labels[groupLabel]
+		w, instances, err := workloadInstances(descriptor, pools)
+		if err != nil {
+			failed[group] = appendError(failed[group], err)
+			continue
+		}
+		if !w.awaitRunning {
+			continue
+		}
+		for _, i := range instances {
+			if err := client.WaitForRunning(i.host, i.name, remaining(deadline)); err != nil {
+				failed[group] = appendError(failed[group], fmt.Errorf("%s on %s unhealthy: %v", i.name, i.host, err))
+			}
+		}
+	}
+	return failed
+}
+
+// time left until the deadline, processes are checked at least once
+func remaining(deadline time.Time) time.Duration {
+	if left := time.Until(deadline); left > 0 {
+		return left
+	}
+	return 0
+}
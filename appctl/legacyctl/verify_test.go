@@ -0,0 +1,32 @@
+package legacyctl
+
+import (
+	"github.com/anliksim/bsc-deployer/config"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	stub := NewStubServer()
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	client := testClient()
+	client.pollInterval = 10 * time.Millisecond
+
+	running := `{"kind": "Deployment", "metadata": {"name": "rest-app",
+		"labels": {"cloud-legacy": "supported", "cloud-group": "rest"}},
+		"spec": {"template": {"metadata": {"annotations": {"legacy/host": "` + server.URL + `"}}}}}`
+	missing := `{"kind": "Deployment", "metadata": {"name": "batch-app",
+		"labels": {"cloud-legacy": "supported", "cloud-group": "batch"}},
+		"spec": {"template": {"metadata": {"annotations": {"legacy/host": "` + server.URL + `"}}}}}`
+	_, err := client.PostProcess(server.URL, []byte(running))
+	assert.NoError(t, err)
+
+	manifests, err := config.DecodeObjects([]byte(running + missing))
+	assert.NoError(t, err)
+	failed := Verify(client, manifests, nil, time.Now().Add(50*time.Millisecond))
+	assert.NotContains(t, failed, "rest")
+	assert.Len(t, failed["batch"], 1)
+}
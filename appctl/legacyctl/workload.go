@@ -0,0 +1,210 @@
+package legacyctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/anliksim/bsc-deployer/config"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"strings"
+	"time"
+)
+
+const kindDeployment = "Deployment"
+const kindStatefulSet = "StatefulSet"
+const kindCronJob = "CronJob"
+const kindConfigMap = "ConfigMap"
+
+const hostAnnotation = "legacy/host"
+const hostsAnnotation = "legacy/hosts"
+const poolAnnotation = "legacy/host-pool"
+
+// kubernetes default for rolling updates of Deployments
+var defaultMaxUnavailable = intstr.FromString("25%")
+
+// legacy view of a descriptor independent of its kind
+type workload struct {
+	kind  string
+	name  string
+	hosts []string
+	// configmaps are shipped as config files instead of run as process
+	config bool
+	// whether to wait for the process to be running after posting it
+	awaitRunning bool
+	readyTimeout time.Duration
+	// number of processes spread across the hosts
+	replicas int
+	// number of processes updated at once
+	maxUnavailable int
+	payload        []byte
+}
+
+// single process or config file set on a host
+type instance struct {
+	name    string
+	host    string
+	payload []byte
+}
+
+// dispatches the descriptor by kind, fails for kinds legacy hosts can not run
+func toWorkload(descriptor config.Object, pools map[string][]string) (*workload, error) {
+	payload := descriptor.Raw
+	w := &workload{
+		kind:     descriptor.Kind,
+		name:     descriptor.Name,
+		replicas: 1,
+		payload:  payload,
+	}
+	var annotations map[string]string
+	switch descriptor.Kind {
+	case kindDeployment:
+		deployment, err := config.JsonToDeployment(payload)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %v", w.kind, w.name, err)
+		}
+		annotations = w.fromPodTemplate(&deployment.Spec.Template, deployment.Spec.Replicas)
+		w.maxUnavailable = maxUnavailable(deployment.Spec.Strategy, w.replicas)
+	case kindStatefulSet:
+		statefulSet, err := config.JsonToStatefulSet(payload)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %v", w.kind, w.name, err)
+		}
+		annotations = w.fromPodTemplate(&statefulSet.Spec.Template, statefulSet.Spec.Replicas)
+		// stateful sets are updated one by one
+		w.maxUnavailable = 1
+	case kindCronJob:
+		// runs on schedule, thus nothing to wait for
+		cronJob, err := config.JsonToCronJob(payload)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %v", w.kind, w.name, err)
+		}
+		annotations = cronJob.Spec.JobTemplate.Spec.Template.Annotations
+	case kindConfigMap:
+		configMap, err := config.JsonToConfigMap(payload)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %v", w.kind, w.name, err)
+		}
+		annotations = configMap.Annotations
+		w.config = true
+	default:
+		return nil, fmt.Errorf("unsupported kind %q of %s, legacy hosts support %s, %s, %s and %s",
+			descriptor.Kind, descriptor.Name, kindDeployment, kindStatefulSet, kindCronJob, kindConfigMap)
+	}
+	hosts, err := resolveHosts(annotations, pools)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s %v", w.kind, w.name, err)
+	}
+	w.hosts = hosts
+	return w, nil
+}
+
+func (w *workload) fromPodTemplate(template *v1.PodTemplateSpec, replicas *int32) map[string]string {
+	if replicas != nil {
+		w.replicas = int(*replicas)
+	}
+	w.awaitRunning = true
+	w.readyTimeout = readyTimeout(template)
+	return template.Annotations
+}
+
+// hosts from the pool, the host list or the single host annotation
+func resolveHosts(annotations map[string]string, pools map[string][]string) ([]string, error) {
+	if pool, ok := annotations[poolAnnotation]; ok {
+		hosts, known := pools[pool]
+		if !known || len(hosts) == 0 {
+			return nil, fmt.Errorf("references unknown host pool %q", pool)
+		}
+		return hosts, nil
+	}
+	if list, ok := annotations[hostsAnnotation]; ok {
+		var hosts []string
+		for _, host := range strings.Split(list, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				hosts = append(hosts, host)
+			}
+		}
+		if len(hosts) > 0 {
+			return hosts, nil
+		}
+	}
+	if host := annotations[hostAnnotation]; host != "" {
+		return []string{host}, nil
+	}
+	return nil, fmt.Errorf("has no %s, %s or %s annotation", hostAnnotation, hostsAnnotation, poolAnnotation)
+}
+
+// number of processes to update at once, at least one
+// as legacy hosts can not surge above the replica count
+func maxUnavailable(strategy appsv1.DeploymentStrategy, replicas int) int {
+	if strategy.Type == appsv1.RecreateDeploymentStrategyType {
+		return replicas
+	}
+	value := defaultMaxUnavailable
+	if strategy.RollingUpdate != nil && strategy.RollingUpdate.MaxUnavailable != nil {
+		value = *strategy.RollingUpdate.MaxUnavailable
+	}
+	unavailable, err := intstr.GetValueFromIntOrPercent(&value, replicas, false)
+	if err != nil || unavailable < 1 {
+		return 1
+	}
+	return unavailable
+}
+
+// spreads the replicas round robin across the hosts, configs and cron jobs
+// are not replicated, configs go to every host and cron jobs to the first
+func (w *workload) instances() ([]instance, error) {
+	switch {
+	case w.config:
+		instances := make([]instance, len(w.hosts))
+		for i, host := range w.hosts {
+			instances[i] = instance{name: w.name, host: host, payload: w.payload}
+		}
+		return instances, nil
+	case !w.awaitRunning:
+		return []instance{{name: w.name, host: w.hosts[0], payload: w.payload}}, nil
+	case w.replicas == 1 && len(w.hosts) == 1:
+		// keep the plain name for single processes
+		return []instance{{name: w.name, host: w.hosts[0], payload: w.payload}}, nil
+	}
+	instances := make([]instance, w.replicas)
+	for i := range instances {
+		name := fmt.Sprintf("%s-%d", w.name, i)
+		payload, err := instancePayload(w.payload, name)
+		if err != nil {
+			return nil, err
+		}
+		instances[i] = instance{name: name, host: w.hosts[i%len(w.hosts)], payload: payload}
+	}
+	return instances, nil
+}
+
+// renames the descriptor to the instance and scales it to a single replica
+func instancePayload(payload []byte, name string) ([]byte, error) {
+	var descriptor map[string]interface{}
+	if err := json.Unmarshal(payload, &descriptor); err != nil {
+		return nil, err
+	}
+	if metadata, ok := descriptor["metadata"].(map[string]interface{}); ok {
+		metadata["name"] = name
+	}
+	if spec, ok := descriptor["spec"].(map[string]interface{}); ok {
+		spec["replicas"] = 1
+	}
+	return json.Marshal(descriptor)
+}
+
+// splits the instances into batches of at most size
+func batches(instances []instance, size int) [][]instance {
+	if size < 1 {
+		size = len(instances)
+	}
+	var result [][]instance
+	for size < len(instances) {
+		instances, result = instances[size:], append(result, instances[:size])
+	}
+	if len(instances) > 0 {
+		result = append(result, instances)
+	}
+	return result
+}
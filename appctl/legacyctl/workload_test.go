@@ -0,0 +1,163 @@
+package legacyctl
+
+import (
+	"fmt"
+	"github.com/anliksim/bsc-deployer/config"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"net/http/httptest"
+	"testing"
+)
+
+const statefulSetDescriptor = `{
+	"apiVersion": "apps/v1",
+	"kind": "StatefulSet",
+	"metadata": {"name": "db"},
+	"spec": {"template": {"metadata": {"annotations": {"legacy/host": "http://legacy-1"}}}}
+}`
+
+const cronJobDescriptor = `{
+	"apiVersion": "batch/v1beta1",
+	"kind": "CronJob",
+	"metadata": {"name": "cleanup"},
+	"spec": {"jobTemplate": {"spec": {"template": {"metadata": {"annotations": {"legacy/host": "http://legacy-1"}}}}}}
+}`
+
+const configMapDescriptor = `{
+	"apiVersion": "v1",
+	"kind": "ConfigMap",
+	"metadata": {
+		"name": "rest-config",
+		"labels": {"cloud-legacy": "supported"},
+		"annotations": {"legacy/host": "%s"}
+	},
+	"data": {"app.properties": "port=8080", "log.xml": "<log/>"}
+}`
+
+const serviceDescriptor = `{
+	"apiVersion": "v1",
+	"kind": "Service",
+	"metadata": {"name": "rest-service"}
+}`
+
+func decodeDescriptor(t *testing.T, descriptor string) config.Object {
+	objects, err := config.DecodeObjects([]byte(descriptor))
+	if err != nil || len(objects) != 1 {
+		t.Fatalf("Invalid test descriptor: %v", err)
+	}
+	return objects[0]
+}
+
+func TestToWorkload_StatefulSet(t *testing.T) {
+	w, err := toWorkload(decodeDescriptor(t, statefulSetDescriptor), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http://legacy-1"}, w.hosts)
+	assert.True(t, w.awaitRunning)
+	assert.False(t, w.config)
+}
+
+func TestToWorkload_CronJob(t *testing.T) {
+	w, err := toWorkload(decodeDescriptor(t, cronJobDescriptor), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http://legacy-1"}, w.hosts)
+	assert.False(t, w.awaitRunning)
+}
+
+func TestToWorkload_UnsupportedKind(t *testing.T) {
+	_, err := toWorkload(decodeDescriptor(t, serviceDescriptor), nil)
+	assert.EqualError(t, err, `unsupported kind "Service" of rest-service, `+
+		`legacy hosts support Deployment, StatefulSet, CronJob and ConfigMap`)
+}
+
+func TestToWorkload_MissingHost(t *testing.T) {
+	_, err := toWorkload(decodeDescriptor(t, testDescriptor), nil)
+	assert.EqualError(t, err, "Deployment rest-app has no legacy/host, legacy/hosts or legacy/host-pool annotation")
+}
+
+func TestRunDeployment_ConfigMap(t *testing.T) {
+	server := httptest.NewServer(NewStubServer())
+	defer server.Close()
+	client := testClient()
+
+	descriptor := decodeDescriptor(t, fmt.Sprintf(configMapDescriptor, server.URL))
+	assert.Empty(t, runDeployment(client, descriptor, nil))
+
+	configs, err := client.ListConfigs(server.URL)
+	assert.NoError(t, err)
+	if assert.Len(t, configs, 1) {
+		assert.Equal(t, []string{"app.properties", "log.xml"}, configs[0].Files)
+	}
+
+	assert.Empty(t, runStop(client, descriptor, nil))
+	configs, err = client.ListConfigs(server.URL)
+	assert.NoError(t, err)
+	assert.Empty(t, configs)
+}
+
+const replicatedDescriptor = `{
+	"apiVersion": "apps/v1",
+	"kind": "Deployment",
+	"metadata": {"name": "rest-app", "labels": {"cloud-legacy": "supported"}},
+	"spec": {
+		"replicas": 3,
+		"strategy": {"rollingUpdate": {"maxUnavailable": 2}},
+		"template": {"metadata": {"annotations": {"legacy/host-pool": "rest"}}}
+	}
+}`
+
+func TestToWorkload_HostPool(t *testing.T) {
+	w, err := toWorkload(decodeDescriptor(t, replicatedDescriptor), map[string][]string{"rest": {"http://a", "http://b"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http://a", "http://b"}, w.hosts)
+	assert.Equal(t, 3, w.replicas)
+	assert.Equal(t, 2, w.maxUnavailable)
+
+	_, err = toWorkload(decodeDescriptor(t, replicatedDescriptor), nil)
+	assert.EqualError(t, err, `Deployment rest-app references unknown host pool "rest"`)
+}
+
+func TestResolveHosts_List(t *testing.T) {
+	hosts, err := resolveHosts(map[string]string{hostsAnnotation: "http://a, http://b,"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http://a", "http://b"}, hosts)
+}
+
+func TestMaxUnavailable(t *testing.T) {
+	percent := intstr.FromString("50%")
+	rolling := appsv1.DeploymentStrategy{RollingUpdate: &appsv1.RollingUpdateDeployment{MaxUnavailable: &percent}}
+	assert.Equal(t, 2, maxUnavailable(rolling, 5))
+	assert.Equal(t, 1, maxUnavailable(appsv1.DeploymentStrategy{}, 3))
+	assert.Equal(t, 3, maxUnavailable(appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType}, 3))
+}
+
+func TestInstances_RoundRobin(t *testing.T) {
+	w, err := toWorkload(decodeDescriptor(t, replicatedDescriptor), map[string][]string{"rest": {"http://a", "http://b"}})
+	assert.NoError(t, err)
+	instances, err := w.instances()
+	assert.NoError(t, err)
+	var placed []string
+	for _, i := range instances {
+		placed = append(placed, i.name+"@"+i.host)
+	}
+	assert.Equal(t, []string{"rest-app-0@http://a", "rest-app-1@http://b", "rest-app-2@http://a"}, placed)
+	assert.Contains(t, string(instances[1].payload), `"name":"rest-app-1"`)
+	assert.Contains(t, string(instances[1].payload), `"replicas":1`)
+
+	assert.Len(t, batches(instances, w.maxUnavailable), 2)
+}
+
+func TestRunDeployment_AcrossHosts(t *testing.T) {
+	a := httptest.NewServer(NewStubServer())
+	defer a.Close()
+	b := httptest.NewServer(NewStubServer())
+	defer b.Close()
+	client := testClient()
+	pools := map[string][]string{"rest": {a.URL, b.URL}}
+
+	assert.Empty(t, runDeployment(client, decodeDescriptor(t, replicatedDescriptor), pools))
+	onA, _ := client.ListProcesses(a.URL)
+	onB, _ := client.ListProcesses(b.URL)
+	assert.Len(t, onA, 2)
+	assert.Len(t, onB, 1)
+}
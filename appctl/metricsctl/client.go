@@ -0,0 +1,94 @@
+package metricsctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultTimeout = 10 * time.Second
+
+// http client for the instant query api of prometheus,
+// GET /api/v1/query, or any compatible endpoint
+type Client struct {
+	url  string
+	http *http.Client
+}
+
+type queryResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// vector sample with its value as [timestamp, "value"]
+type sample struct {
+	Metric map[string]string `json:"metric"`
+	Value  []interface{}     `json:"value"`
+}
+
+func NewClient(baseUrl string, timeout time.Duration) *Client {
+	return &Client{
+		url:  strings.TrimSuffix(baseUrl, "/"),
+		http: &http.Client{Timeout: timeout},
+	}
+}
+
+// runs the query and returns its single value, queries
+// returning no or several series fail
+func (c *Client) Query(query string) (float64, error) {
+	res, err := c.http.Get(c.url + "/api/v1/query?query=" + url.QueryEscape(query))
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return 0, err
+	}
+	response := new(queryResponse)
+	if err := json.Unmarshal(body, response); err != nil {
+		return 0, fmt.Errorf("%s responded with %d: %s", c.url, res.StatusCode, body)
+	}
+	if response.Status != "success" {
+		return 0, fmt.Errorf("query %q failed: %s", query, response.Error)
+	}
+	return singleValue(query, response.Data.ResultType, response.Data.Result)
+}
+
+func singleValue(query string, resultType string, result json.RawMessage) (float64, error) {
+	var value []interface{}
+	switch resultType {
+	case "scalar":
+		if err := json.Unmarshal(result, &value); err != nil {
+			return 0, err
+		}
+	case "vector":
+		var samples []sample
+		if err := json.Unmarshal(result, &samples); err != nil {
+			return 0, err
+		}
+		if len(samples) != 1 {
+			return 0, fmt.Errorf("query %q returned %d series, expected one", query, len(samples))
+		}
+		value = samples[0].Value
+	default:
+		return 0, fmt.Errorf("query %q returned unsupported result type %q", query, resultType)
+	}
+	if len(value) != 2 {
+		return 0, fmt.Errorf("query %q returned invalid value %v", query, value)
+	}
+	str, ok := value[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("query %q returned invalid value %v", query, value)
+	}
+	return strconv.ParseFloat(str, 64)
+}
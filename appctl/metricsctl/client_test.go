@@ -0,0 +1,58 @@
+package metricsctl
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestQuery_Stub(t *testing.T) {
+	stub := NewStubServer(0.5)
+	stub.Set(`rate(errors{app="rest"}[1m])`, 0.01)
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	client := NewClient(server.URL, DefaultTimeout)
+
+	value, err := client.Query(`rate(errors{app="rest"}[1m])`)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.01, value)
+
+	value, err = client.Query("up")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, value)
+}
+
+func TestQuery_Vector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status": "success", "data": {"resultType": "vector",
+			"result": [{"metric": {"app": "rest"}, "value": [1588334400, "42"]}]}}`))
+	}))
+	defer server.Close()
+
+	value, err := NewClient(server.URL, DefaultTimeout).Query("up")
+	assert.NoError(t, err)
+	assert.Equal(t, 42.0, value)
+}
+
+func TestQuery_SeveralSeries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status": "success", "data": {"resultType": "vector",
+			"result": [{"value": [1588334400, "1"]}, {"value": [1588334400, "2"]}]}}`))
+	}))
+	defer server.Close()
+
+	_, err := NewClient(server.URL, DefaultTimeout).Query("up")
+	assert.Error(t, err)
+}
+
+func TestQuery_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"status": "error", "error": "parse error"}`))
+	}))
+	defer server.Close()
+
+	_, err := NewClient(server.URL, DefaultTimeout).Query("up{")
+	assert.Error(t, err)
+}
@@ -0,0 +1,58 @@
+package metricsctl
+
+import (
+	"github.com/anliksim/bsc-deployer/util"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// in-memory query api returning fixed values, used by
+// tests and for local development of canary deployments
+type StubServer struct {
+	lock sync.Mutex
+	// value returned for queries without their own value
+	defaultValue float64
+	values       map[string]float64
+}
+
+func NewStubServer(defaultValue float64) *StubServer {
+	return &StubServer{defaultValue: defaultValue, values: make(map[string]float64)}
+}
+
+// sets the value returned for the exact query
+func (s *StubServer) Set(query string, value float64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.values[query] = value
+}
+
+func (s *StubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/v1/query" {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.FormValue("query")
+	if query == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		util.RespondJson(w, map[string]string{"status": "error", "error": "missing query"})
+		return
+	}
+	s.lock.Lock()
+	value, ok := s.values[query]
+	if !ok {
+		value = s.defaultValue
+	}
+	s.lock.Unlock()
+	util.RespondJson(w, map[string]interface{}{
+		"status": "success",
+		"data": map[string]interface{}{
+			"resultType": "scalar",
+			"result": []interface{}{
+				float64(time.Now().Unix()),
+				strconv.FormatFloat(value, 'f', -1, 64),
+			},
+		},
+	})
+}
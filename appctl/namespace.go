@@ -0,0 +1,215 @@
+package appctl
+
+import (
+	"fmt"
+	"github.com/anliksim/bsc-deployer/appctl/kubectl"
+	"github.com/anliksim/bsc-deployer/config"
+	"log"
+	"sort"
+	"strings"
+)
+
+// label of the namespaces created by the deployer
+const managedLabel = "deployer/managed"
+const managedValue = "true"
+
+const kindNamespace = "Namespace"
+
+// set on the token secrets kubernetes creates for service accounts
+const serviceAccountAnnotation = "kubernetes.io/service-account.name"
+
+// namespaces never deleted, even if labelled as managed
+var systemNamespaces = map[string]bool{
+	"default":         true,
+	"kube-system":     true,
+	"kube-public":     true,
+	"kube-node-lease": true,
+}
+
+// objects kubernetes creates in every namespace
+var defaultObjects = map[string]bool{
+	"ServiceAccount/default":     true,
+	"ConfigMap/kube-root-ca.crt": true,
+}
+
+// managed namespace of a cloud removed from the env repo
+type namespaceRemoval struct {
+	cloud cloud
+	name  string
+	// objects deleted along with the namespace
+	objects int
+}
+
+// namespaces of the env repo
+func loadNamespaces(dir string, rev string) ([]config.Object, error) {
+	objects, err := loadEnvManifests(namespacesPath(dir), dir, rev)
+	if err != nil {
+		return nil, err
+	}
+	var namespaces []config.Object
+	for _, object := range objects {
+		if object.Kind != kindNamespace {
+			log.Printf("Skipping %s %s in namespaces, only namespaces are applied", object.Kind, object.Name)
+			continue
+		}
+		namespaces = append(namespaces, object)
+	}
+	return namespaces, nil
+}
+
+// applies the namespaces, the ones created by the deployer are labelled as managed
+func setUpNamespaces(c cloud, namespaces []config.Object) error {
+	existing, err := kubectl.GetNamespaces(c.context, "")
+	if err != nil {
+		return err
+	}
+	labelled, err := labelManaged(namespaces, existing)
+	if err != nil {
+		return err
+	}
+	_, err = kubectl.ApplyWithSelector(c.context, labelled, "")
+	return err
+}
+
+// labels the namespaces that do not exist yet or were created by the deployer
+// before as managed, existing namespaces without the label are left as they are
+func labelManaged(namespaces []config.Object, existing []config.Object) ([]config.Object, error) {
+	var labelled []config.Object
+	for _, namespace := range namespaces {
+		if live, exists := findNamespace(existing, namespace.Name); exists && live.Labels[managedLabel] != managedValue {
+			labelled = append(labelled, namespace)
+			continue
+		}
+		managed, err := namespace.WithLabels(map[string]string{managedLabel: managedValue})
+		if err != nil {
+			return nil, err
+		}
+		labelled = append(labelled, managed)
+	}
+	return labelled, nil
+}
+
+// managed namespaces removed from the env repo that are not in use,
+// with the number of objects in them to guard their deletion
+func plannedNamespaceRemovals(namespaces []config.Object, result *Result) []namespaceRemoval {
+	var removals []namespaceRemoval
+	for _, c := range clouds {
+		if !kubectl.HasContext(c.context) {
+			continue
+		}
+		managed, err := kubectl.GetNamespaces(c.context, fmt.Sprintf(eqSelector, managedLabel, managedValue))
+		if err != nil {
+			log.Printf("Failed to read managed namespaces of %s: %v", c.context, err)
+			continue
+		}
+		for _, name := range removedNamespaces(managed, namespaces) {
+			objects, ok := namespaceObjects(c, name, result)
+			if ok {
+				removals = append(removals, namespaceRemoval{cloud: c, name: name, objects: len(objects)})
+			}
+		}
+	}
+	return removals
+}
+
+// deletes the planned namespaces unless they got in use since
+func pruneNamespaces(removals []namespaceRemoval, result *Result) {
+	for _, removal := range removals {
+		deleteNamespace(removal.cloud, removal.name, result)
+	}
+}
+
+// deletes the namespaces of the env repo the deployer manages
+func deleteNamespaces(c cloud, namespaces []config.Object, result *Result) {
+	managed, err := kubectl.GetNamespaces(c.context, fmt.Sprintf(eqSelector, managedLabel, managedValue))
+	if err != nil {
+		result.addError(err)
+		return
+	}
+	for _, namespace := range namespaces {
+		if containsNamespace(managed, namespace.Name) {
+			deleteNamespace(c, namespace.Name, result)
+		} else {
+			result.addDecisions([]string{fmt.Sprintf("namespace %s kept on %s, not managed by the deployer",
+				namespace.Name, c.context)})
+		}
+	}
+}
+
+// deletes the namespace unless it contains objects the deployer did not apply
+func deleteNamespace(c cloud, name string, result *Result) {
+	if _, ok := namespaceObjects(c, name, result); !ok {
+		return
+	}
+	log.Printf("Deleting namespace %s from %s...", name, c.context)
+	result.addError(kubectl.DeleteNamespace(c.context, name))
+}
+
+// objects in the namespace, false if it must be kept
+func namespaceObjects(c cloud, name string, result *Result) ([]config.Object, bool) {
+	if systemNamespaces[name] {
+		result.addDecisions([]string{fmt.Sprintf("namespace %s kept on %s, system namespace", name, c.context)})
+		return nil, false
+	}
+	objects, err := kubectl.GetNamespacedObjects(c.context, name)
+	if err != nil {
+		// unknown content is treated like unmanaged objects
+		log.Printf("Error listing objects of namespace %s on %s: %v", name, c.context, err)
+		result.addDecisions([]string{fmt.Sprintf("namespace %s kept on %s, its objects cannot be listed", name, c.context)})
+		return nil, false
+	}
+	if unmanaged := unmanagedObjects(objects); len(unmanaged) > 0 {
+		result.addDecisions([]string{fmt.Sprintf("namespace %s kept on %s, contains unmanaged objects %s",
+			name, c.context, strings.Join(unmanaged, ", "))})
+		return nil, false
+	}
+	return objects, true
+}
+
+// names of the managed namespaces that are not part of the env repo
+func removedNamespaces(managed []config.Object, namespaces []config.Object) []string {
+	var removed []string
+	for _, namespace := range managed {
+		if !containsNamespace(namespaces, namespace.Name) {
+			removed = append(removed, namespace.Name)
+		}
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// kind/name of the objects without the deployment id the deployer stamps on applied
+// objects, objects owned by others, e.g. pods, and the defaults of every namespace
+// are skipped, their owners or the namespace tell whether it is in use
+func unmanagedObjects(objects []config.Object) []string {
+	var unmanaged []string
+	for _, object := range objects {
+		if object.Annotations[deploymentIdAnnotation] != "" || object.Owned || isDefaultObject(object) {
+			continue
+		}
+		unmanaged = append(unmanaged, strings.ToLower(object.Kind)+"/"+object.Name)
+	}
+	return unmanaged
+}
+
+func isDefaultObject(object config.Object) bool {
+	// tokens of service accounts and endpoints of services
+	if object.Annotations[serviceAccountAnnotation] != "" || object.Kind == "Endpoints" {
+		return true
+	}
+	return defaultObjects[object.Kind+"/"+object.Name]
+}
+
+func containsNamespace(namespaces []config.Object, name string) bool {
+	_, found := findNamespace(namespaces, name)
+	return found
+}
+
+func findNamespace(namespaces []config.Object, name string) (config.Object, bool) {
+	for _, namespace := range namespaces {
+		if namespace.Name == name {
+			return namespace, true
+		}
+	}
+	return config.Object{}, false
+}
@@ -0,0 +1,97 @@
+package appctl
+
+import (
+	"github.com/anliksim/bsc-deployer/config"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const namespacesYaml = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: rest
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: misplaced
+`
+
+func TestLoadNamespaces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "env")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.Mkdir(namespacesPath(dir), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(namespacesPath(dir), "rest.yaml"), []byte(namespacesYaml), 0644))
+
+	namespaces, err := loadNamespaces(dir, "ff755b0")
+	assert.NoError(t, err)
+	if assert.Len(t, namespaces, 1) {
+		assert.Equal(t, "rest", namespaces[0].Name)
+		// labelled once it is known whether the deployer creates it
+		assert.Empty(t, namespaces[0].Labels)
+	}
+}
+
+func TestLabelManaged(t *testing.T) {
+	namespaces := []config.Object{
+		{Kind: kindNamespace, Name: "default", Raw: []byte(`{"kind":"Namespace","metadata":{"name":"default"}}`)},
+		{Kind: kindNamespace, Name: "rest", Raw: []byte(`{"kind":"Namespace","metadata":{"name":"rest"}}`)},
+		{Kind: kindNamespace, Name: "monitoring", Raw: []byte(`{"kind":"Namespace","metadata":{"name":"monitoring"}}`)},
+	}
+	existing := []config.Object{
+		{Kind: kindNamespace, Name: "default"},
+		{Kind: kindNamespace, Name: "rest", Labels: map[string]string{managedLabel: managedValue}},
+	}
+
+	labelled, err := labelManaged(namespaces, existing)
+	assert.NoError(t, err)
+	if assert.Len(t, labelled, 3) {
+		assert.Empty(t, labelled[0].Labels)
+		assert.Equal(t, managedValue, labelled[1].Labels[managedLabel])
+		assert.Equal(t, managedValue, labelled[2].Labels[managedLabel])
+	}
+}
+
+func TestLoadNamespaces_Template(t *testing.T) {
+	dir, err := ioutil.TempDir("", "env")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "vars"), 0755))
+	assert.NoError(t, os.Mkdir(namespacesPath(dir), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "vars", privateContext+".yaml"), []byte("team: rest\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(namespacesPath(dir), "team.yaml.tmpl"),
+		[]byte("kind: Namespace\nmetadata:\n  name: {{ .Vars.team | quote }}\n"), 0644))
+
+	namespaces, err := loadNamespaces(dir, "ff755b0")
+	assert.NoError(t, err)
+	if assert.Len(t, namespaces, 1) {
+		assert.Equal(t, "rest", namespaces[0].Name)
+	}
+}
+
+func TestRemovedNamespaces(t *testing.T) {
+	managed := []config.Object{{Name: "rest"}, {Name: "old-b"}, {Name: "old-a"}}
+	namespaces := []config.Object{{Name: "rest"}, {Name: "monitoring"}}
+
+	assert.Equal(t, []string{"old-a", "old-b"}, removedNamespaces(managed, namespaces))
+	assert.Empty(t, removedNamespaces(nil, namespaces))
+}
+
+func TestUnmanagedObjects(t *testing.T) {
+	objects := []config.Object{
+		{Kind: "Deployment", Name: "rest", Annotations: map[string]string{deploymentIdAnnotation: "20200501-120000.000"}},
+		{Kind: "Pod", Name: "rest-5d8f7c-x2x4k", Owned: true},
+		{Kind: "ServiceAccount", Name: "default"},
+		{Kind: "Secret", Name: "default-token-7bq2x", Annotations: map[string]string{serviceAccountAnnotation: "default"}},
+		{Kind: "Endpoints", Name: "rest"},
+		{Kind: "PersistentVolumeClaim", Name: "data"},
+		{Kind: "Pod", Name: "debug"},
+	}
+
+	assert.Equal(t, []string{"persistentvolumeclaim/data", "pod/debug"}, unmanagedObjects(objects))
+	assert.Empty(t, unmanagedObjects(objects[:5]))
+}
@@ -0,0 +1,88 @@
+package appctl
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// orders the groups into waves, each group after the groups it depends on,
+// the groups of a wave do not depend on each other and are sorted by name
+func dependencyWaves(groups []string, dependsOn map[string][]string) ([][]string, error) {
+	pending := make(map[string]bool)
+	for _, group := range groups {
+		pending[group] = true
+	}
+	for _, group := range groups {
+		for _, dependency := range dependsOn[group] {
+			if !pending[dependency] {
+				log.Printf("Ignoring dependency of %s on unknown cloud group %s", group, dependency)
+			}
+		}
+	}
+	var waves [][]string
+	for len(pending) > 0 {
+		var wave []string
+		for group := range pending {
+			if !dependsOnAny(group, dependsOn, pending) {
+				wave = append(wave, group)
+			}
+		}
+		if len(wave) == 0 {
+			return nil, fmt.Errorf("cyclic cloud group dependencies: %s", findCycle(pending, dependsOn))
+		}
+		sort.Strings(wave)
+		for _, group := range wave {
+			delete(pending, group)
+		}
+		waves = append(waves, wave)
+	}
+	return waves, nil
+}
+
+func dependsOnAny(group string, dependsOn map[string][]string, groups map[string]bool) bool {
+	for _, dependency := range dependsOn[group] {
+		if groups[dependency] {
+			return true
+		}
+	}
+	return false
+}
+
+// follows the dependencies of the remaining groups, which all
+// depend on another remaining group, until a group repeats
+func findCycle(remaining map[string]bool, dependsOn map[string][]string) string {
+	var groups []string
+	for group := range remaining {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	path := []string{groups[0]}
+	seen := map[string]int{groups[0]: 0}
+	for {
+		current := path[len(path)-1]
+		var next string
+		for _, dependency := range dependsOn[current] {
+			if remaining[dependency] {
+				next = dependency
+				break
+			}
+		}
+		if start, ok := seen[next]; ok {
+			return strings.Join(append(path[start:], next), " -> ")
+		}
+		seen[next] = len(path)
+		path = append(path, next)
+	}
+}
+
+// first dependency of the group that failed, empty if none
+func failedDependency(group string, dependsOn map[string][]string, failed map[string]bool) string {
+	for _, dependency := range dependsOn[group] {
+		if failed[dependency] {
+			return dependency
+		}
+	}
+	return ""
+}
@@ -0,0 +1,31 @@
+package appctl
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDependencyWaves(t *testing.T) {
+	waves, err := dependencyWaves([]string{"rest", "rest-db", "monitoring", "batch"}, map[string][]string{
+		"rest":    {"rest-db", "monitoring"},
+		"rest-db": {"monitoring"},
+		"batch":   {"unknown"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"batch", "monitoring"}, {"rest-db"}, {"rest"}}, waves)
+}
+
+func TestDependencyWaves_Cycle(t *testing.T) {
+	_, err := dependencyWaves([]string{"a", "b", "c", "d"}, map[string][]string{
+		"a": {"b"},
+		"b": {"c"},
+		"c": {"a"},
+		"d": {"a"},
+	})
+	assert.EqualError(t, err, "cyclic cloud group dependencies: a -> b -> c -> a")
+}
+
+func TestDependencyWaves_SelfDependency(t *testing.T) {
+	_, err := dependencyWaves([]string{"a"}, map[string][]string{"a": {"a"}})
+	assert.EqualError(t, err, "cyclic cloud group dependencies: a -> a")
+}
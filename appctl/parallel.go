@@ -0,0 +1,284 @@
+package appctl
+
+import (
+	"fmt"
+	"github.com/anliksim/bsc-deployer/appctl/kubectl"
+	"github.com/anliksim/bsc-deployer/config"
+	"log"
+	"sync"
+	"time"
+)
+
+const defaultParallelism = 4
+
+// number of cloud-groups applied concurrently per cloud
+var parallelism = defaultParallelism
+
+const actionApply = "apply"
+const actionDelete = "delete"
+
+// what to do with a group on a cloud
+type action struct {
+	kind string
+	// cloud whose cloud-env label selects the objects to apply
+	as cloud
+}
+
+// outcome of a deployment on a single cloud
+type CloudResult struct {
+	Cloud string
+	// groups applied, failed or skipped as a group they depend on failed
+	Deployed []string
+	Failed   []string
+	Skipped  []string
+	Duration time.Duration
+}
+
+// deploys the groups to the clouds concurrently, each cloud works through
+// the dependency waves on its own, so a slow or failing cloud does not
+// hold up the others, groups failing on a cloud skip their dependents there
+type cloudRunner struct {
+	request      Request
+	manifests    map[string][]config.Object
+	waves        [][]string
+	dependencies map[string][]string
+	result       *Result
+	lock         sync.Mutex
+	placements   []placement
+	// failed groups by cloud
+	failed  map[string]map[string]bool
+	summary map[string]*CloudResult
+}
+
+func newCloudRunner(request Request, manifests map[string][]config.Object, waves [][]string,
+	dependencies map[string][]string, result *Result) *cloudRunner {
+	return &cloudRunner{
+		request:      request,
+		manifests:    manifests,
+		waves:        waves,
+		dependencies: dependencies,
+		result:       result,
+		failed:       make(map[string]map[string]bool),
+		summary:      make(map[string]*CloudResult),
+	}
+}
+
+// splits the placement of the groups into the actions per cloud and group applied first
+// and the ones run on promotion, i.e. the applies to the next clouds if rollouts are
+// progressive and the deletes from the other clouds, so a group is removed from a
+// cloud only once it is deployed to all of its targets
+func planStages(targets map[string][]target) (map[string]map[string]action, map[string]map[string]action) {
+	initial := make(map[string]map[string]action)
+	promotion := make(map[string]map[string]action)
+	add := func(stage map[string]map[string]action, c cloud, cg string, a action) {
+		if stage[c.context] == nil {
+			stage[c.context] = make(map[string]action)
+		}
+		stage[c.context][cg] = a
+	}
+	for cg, placed := range targets {
+		first, promote := placed, []target(nil)
+		if progressive.enabled && len(placed) > 1 {
+			first, promote = placed[:1], placed[1:]
+		}
+		for _, t := range first {
+			add(initial, t.cloud, cg, action{kind: actionApply, as: t.as})
+		}
+		for _, t := range promote {
+			add(promotion, t.cloud, cg, action{kind: actionApply, as: t.as})
+		}
+		// delete apps in case they were on the other clouds before
+		for _, c := range clouds {
+			if !placedOn(placed, c) {
+				add(promotion, c, cg, action{kind: actionDelete})
+			}
+		}
+	}
+	return initial, promotion
+}
+
+// groups with actions of the given kind in the stage
+func stageGroups(stage map[string]map[string]action, kind string) map[string]bool {
+	groups := make(map[string]bool)
+	for _, actions := range stage {
+		for cg, a := range actions {
+			if a.kind == kind {
+				groups[cg] = true
+			}
+		}
+	}
+	return groups
+}
+
+// actions of the stage for the given groups only
+func onlyGroups(stage map[string]map[string]action, groups map[string]bool) map[string]map[string]action {
+	filtered := make(map[string]map[string]action)
+	for context, actions := range stage {
+		for cg, a := range actions {
+			if !groups[cg] {
+				continue
+			}
+			if filtered[context] == nil {
+				filtered[context] = make(map[string]action)
+			}
+			filtered[context][cg] = a
+		}
+	}
+	return filtered
+}
+
+func placedOn(targets []target, c cloud) bool {
+	for _, t := range targets {
+		if t.cloud == c {
+			return true
+		}
+	}
+	return false
+}
+
+// runs the actions of the stage on the available clouds concurrently
+func (r *cloudRunner) run(stage map[string]map[string]action, available map[string]bool) {
+	var wg sync.WaitGroup
+	for _, c := range clouds {
+		actions := stage[c.context]
+		if !available[c.context] || len(actions) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(c cloud) {
+			defer wg.Done()
+			r.runCloud(c, actions)
+		}(c)
+	}
+	wg.Wait()
+}
+
+// applies the groups in dependency order, then deletes the groups in reverse
+// order so dependents go before their dependencies, failed deletes are recorded
+// but do not skip applies of dependent groups
+func (r *cloudRunner) runCloud(c cloud, actions map[string]action) {
+	started := time.Now()
+	for _, wave := range r.waves {
+		var groups []string
+		for _, cg := range wave {
+			if actions[cg].kind != actionApply {
+				continue
+			}
+			if dependency := r.failedDependency(c, cg); dependency != "" {
+				r.result.addError(fmt.Errorf("skipped cloud group %s on %s as %s failed", cg, c.context, dependency))
+				r.record(c, cg, func(s *CloudResult) { s.Skipped = append(s.Skipped, cg) }, true)
+				continue
+			}
+			groups = append(groups, cg)
+		}
+		inPool(groups, parallelism, func(cg string) {
+			r.apply(c, cg, actions[cg].as)
+		})
+	}
+	for i := len(r.waves) - 1; i >= 0; i-- {
+		var groups []string
+		for _, cg := range r.waves[i] {
+			if actions[cg].kind == actionDelete {
+				groups = append(groups, cg)
+			}
+		}
+		inPool(groups, parallelism, func(cg string) {
+			r.delete(c, cg)
+		})
+	}
+	r.record(c, "", func(s *CloudResult) { s.Duration += time.Since(started) }, false)
+}
+
+func (r *cloudRunner) apply(c cloud, cg string, as cloud) {
+	groupResult := r.result.forGroup()
+	log.Printf("Deploying cloud group %s to %s...", cg, c.context)
+	p := applyGroup(r.request, c, as, cg, r.manifests[c.context], groupResult)
+	r.lock.Lock()
+	r.placements = append(r.placements, p)
+	r.lock.Unlock()
+	r.result.merge(groupResult)
+	if groupResult.Failed() {
+		r.record(c, cg, func(s *CloudResult) { s.Failed = append(s.Failed, cg) }, true)
+	} else {
+		r.record(c, cg, func(s *CloudResult) { s.Deployed = append(s.Deployed, cg) }, false)
+	}
+}
+
+func (r *cloudRunner) delete(c cloud, cg string) {
+	log.Printf("Deleting cloud group %s from %s...", cg, c.context)
+	if err := kubectl.DeleteWithSelector(c.context, r.manifests[c.context], groupSelector(cg)); err != nil {
+		r.result.addError(err)
+		r.record(c, cg, func(s *CloudResult) { s.Failed = append(s.Failed, cg) }, false)
+	}
+}
+
+// groups failed or skipped on any cloud so far
+func (r *cloudRunner) failedGroups() map[string]bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	failed := make(map[string]bool)
+	for _, groups := range r.failed {
+		for cg := range groups {
+			failed[cg] = true
+		}
+	}
+	return failed
+}
+
+func (r *cloudRunner) failedDependency(c cloud, cg string) string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return failedDependency(cg, r.dependencies, r.failed[c.context])
+}
+
+// updates the summary of the cloud and marks the group as failed there
+func (r *cloudRunner) record(c cloud, cg string, update func(*CloudResult), failed bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	summary, ok := r.summary[c.context]
+	if !ok {
+		summary = &CloudResult{Cloud: c.context}
+		r.summary[c.context] = summary
+	}
+	update(summary)
+	if failed {
+		if r.failed[c.context] == nil {
+			r.failed[c.context] = make(map[string]bool)
+		}
+		r.failed[c.context][cg] = true
+	}
+}
+
+// summaries of the clouds in the order of the clouds
+func (r *cloudRunner) cloudResults() []CloudResult {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var results []CloudResult
+	for _, c := range clouds {
+		if summary, ok := r.summary[c.context]; ok {
+			results = append(results, *summary)
+		}
+	}
+	return results
+}
+
+// runs fn for the items with at most size running at once and waits for all
+func inPool(items []string, size int, fn func(item string)) {
+	if size < 1 {
+		size = 1
+	}
+	slots := make(chan struct{}, size)
+	var wg sync.WaitGroup
+	for _, item := range items {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(item string) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			fn(item)
+		}(item)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,85 @@
+package appctl
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPlanStages(t *testing.T) {
+	targets := map[string][]target{
+		"rest-ha":    {{cloud: private, as: private}, {cloud: public, as: public}},
+		"monitoring": {{cloud: private, as: private}},
+	}
+
+	initial, promotion := planStages(targets)
+	assert.Equal(t, map[string]map[string]action{
+		privateContext: {"rest-ha": {kind: actionApply, as: private}, "monitoring": {kind: actionApply, as: private}},
+		publicContext:  {"rest-ha": {kind: actionApply, as: public}},
+	}, initial)
+	// deleted once deployed
+	assert.Equal(t, map[string]map[string]action{publicContext: {"monitoring": {kind: actionDelete}}}, promotion)
+}
+
+func TestPlanStages_Failover(t *testing.T) {
+	targets := map[string][]target{"rest": {{cloud: public, as: private}}}
+
+	initial, promotion := planStages(targets)
+	assert.Equal(t, map[string]map[string]action{publicContext: {"rest": {kind: actionApply, as: private}}}, initial)
+	assert.Equal(t, map[string]map[string]action{privateContext: {"rest": {kind: actionDelete}}}, promotion)
+}
+
+func TestOnlyGroups(t *testing.T) {
+	stage := map[string]map[string]action{
+		privateContext: {"rest": {kind: actionDelete}},
+		publicContext:  {"rest-ha": {kind: actionApply, as: public}, "rest": {kind: actionApply, as: private}},
+	}
+
+	assert.Equal(t, map[string]bool{"rest-ha": true, "rest": true}, stageGroups(stage, actionApply))
+	assert.Equal(t, map[string]map[string]action{
+		publicContext: {"rest-ha": {kind: actionApply, as: public}},
+	}, onlyGroups(stage, map[string]bool{"rest-ha": true, "rest": false}))
+}
+
+func TestPlanStages_Progressive(t *testing.T) {
+	progressive.enabled = true
+	defer func() { progressive.enabled = false }()
+	targets := map[string][]target{"rest-ha": {{cloud: private, as: private}, {cloud: public, as: public}}}
+
+	initial, promotion := planStages(targets)
+	assert.Equal(t, map[string]map[string]action{privateContext: {"rest-ha": {kind: actionApply, as: private}}}, initial)
+	assert.Equal(t, map[string]map[string]action{publicContext: {"rest-ha": {kind: actionApply, as: public}}}, promotion)
+}
+
+func TestInPool_Bounded(t *testing.T) {
+	var lock sync.Mutex
+	var ran []string
+	running, maxRunning := 0, 0
+	inPool([]string{"a", "b", "c", "d", "e"}, 2, func(item string) {
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		lock.Lock()
+		running--
+		ran = append(ran, item)
+		lock.Unlock()
+	})
+	sort.Strings(ran)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, ran)
+	assert.Equal(t, 2, maxRunning)
+}
+
+func TestCloudRunner_RecordIsolatesClouds(t *testing.T) {
+	runner := newCloudRunner(Request{}, nil, nil, map[string][]string{"rest": {"rest-db"}}, newResult())
+	runner.record(public, "rest-db", func(s *CloudResult) { s.Failed = append(s.Failed, "rest-db") }, true)
+
+	assert.Equal(t, "rest-db", runner.failedDependency(public, "rest"))
+	assert.Empty(t, runner.failedDependency(private, "rest"))
+	assert.Equal(t, []CloudResult{{Cloud: publicContext, Failed: []string{"rest-db"}}}, runner.cloudResults())
+}
@@ -0,0 +1,122 @@
+package appctl
+
+import (
+	"errors"
+	"fmt"
+	"github.com/anliksim/bsc-deployer/appctl/kubectl"
+	"github.com/anliksim/bsc-deployer/config"
+	"log"
+	"sync"
+	"time"
+)
+
+const defaultApprovalTimeout = time.Hour
+
+var ErrNotAwaitingApproval = errors.New("deployment is not awaiting approval")
+
+// staged rollout of groups placed on several clouds, disabled by default
+var progressive struct {
+	enabled bool
+	// time the first wave has to stay healthy before promotion
+	bakeTime time.Duration
+	// whether promotion waits for Approve
+	approval        bool
+	approvalTimeout time.Duration
+}
+
+// promotion gates of the deployments waiting for approval by id
+var approvals = struct {
+	sync.Mutex
+	pending map[string]chan struct{}
+}{pending: make(map[string]chan struct{})}
+
+func configureProgressive(progressiveConfig config.ProgressiveConfig) {
+	progressive.enabled = progressiveConfig.Enabled
+	progressive.bakeTime = time.Duration(progressiveConfig.BakeSeconds) * time.Second
+	progressive.approval = progressiveConfig.Approval
+	progressive.approvalTimeout = defaultApprovalTimeout
+	if progressiveConfig.ApprovalTimeoutSeconds > 0 {
+		progressive.approvalTimeout = time.Duration(progressiveConfig.ApprovalTimeoutSeconds) * time.Second
+	}
+}
+
+// lets the deployment pass the gate it waits at, i.e. promote its
+// groups to the next clouds or delete beyond the deletion guard
+func Approve(id string) error {
+	approvals.Lock()
+	defer approvals.Unlock()
+	gate, ok := approvals.pending[id]
+	if !ok {
+		return ErrNotAwaitingApproval
+	}
+	delete(approvals.pending, id)
+	close(gate)
+	return nil
+}
+
+func AwaitingApproval(id string) bool {
+	approvals.Lock()
+	defer approvals.Unlock()
+	_, ok := approvals.pending[id]
+	return ok
+}
+
+// whether to promote each of the groups: the group did not fail on the first
+// clouds and is still healthy there after the bake time if any, the approval
+// if required covers all groups, groups not promoted fail the deployment
+func gatePromotion(request Request, groups map[string]bool, firstWave []placement, failed map[string]bool, result *Result) map[string]bool {
+	promoted := make(map[string]bool)
+	passing := 0
+	for cg := range groups {
+		promoted[cg] = !failed[cg]
+		if failed[cg] {
+			result.addError(fmt.Errorf("cloud group %s failed on the first clouds, not promoting it", cg))
+		} else {
+			passing++
+		}
+	}
+	if passing > 0 && progressive.bakeTime > 0 {
+		log.Printf("Baking for %v before promotion...", progressive.bakeTime)
+		time.Sleep(progressive.bakeTime)
+		for _, p := range firstWave {
+			if !promoted[p.group] {
+				continue
+			}
+			for _, rollout := range kubectl.WaitForRollouts(p.cloud.context, kubectl.Workloads(p.objects), rolloutTimeout) {
+				if !rollout.Ready() {
+					result.addError(fmt.Errorf("cloud group %s unhealthy after bake time, not promoting it: %v", p.group, rollout.Err))
+					promoted[p.group] = false
+					passing--
+					break
+				}
+			}
+		}
+	}
+	if passing > 0 && progressive.approval {
+		log.Printf("Deployment %s awaits approval for up to %v...", request.Id, progressive.approvalTimeout)
+		if err := awaitApproval(request.Id, progressive.approvalTimeout); err != nil {
+			result.addError(fmt.Errorf("%v, not promoting to the next clouds", err))
+			for cg := range promoted {
+				promoted[cg] = false
+			}
+		}
+	}
+	return promoted
+}
+
+func awaitApproval(id string, timeout time.Duration) error {
+	gate := make(chan struct{})
+	approvals.Lock()
+	approvals.pending[id] = gate
+	approvals.Unlock()
+	select {
+	case <-gate:
+		log.Printf("Deployment %s approved", id)
+		return nil
+	case <-time.After(timeout):
+		approvals.Lock()
+		delete(approvals.pending, id)
+		approvals.Unlock()
+		return fmt.Errorf("not approved within %v", timeout)
+	}
+}
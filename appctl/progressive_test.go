@@ -0,0 +1,42 @@
+package appctl
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestAwaitApproval_Approved(t *testing.T) {
+	approved := make(chan error)
+	go func() {
+		approved <- awaitApproval("1", time.Second)
+	}()
+	assert.Eventually(t, func() bool { return AwaitingApproval("1") }, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, Approve("1"))
+	assert.NoError(t, <-approved)
+	assert.False(t, AwaitingApproval("1"))
+}
+
+func TestAwaitApproval_Timeout(t *testing.T) {
+	assert.Error(t, awaitApproval("2", 10*time.Millisecond))
+	assert.Equal(t, ErrNotAwaitingApproval, Approve("2"))
+}
+
+func TestGatePromotion_FailedFirstWave(t *testing.T) {
+	progressive.approval = true
+	defer func() { progressive.approval = false }()
+	result := newResult()
+	promoted := gatePromotion(Request{Id: "3"}, map[string]bool{"rest": true}, nil, map[string]bool{"rest": true}, result)
+	assert.Equal(t, map[string]bool{"rest": false}, promoted)
+	assert.True(t, result.Failed())
+	// nothing left to approve
+	assert.False(t, AwaitingApproval("3"))
+}
+
+func TestGatePromotion_PerGroup(t *testing.T) {
+	result := newResult()
+	promoted := gatePromotion(Request{Id: "4"}, map[string]bool{"rest": true, "monitoring": true}, nil, map[string]bool{"monitoring": true}, result)
+	assert.Equal(t, map[string]bool{"rest": true, "monitoring": false}, promoted)
+	assert.Len(t, result.Errors, 1)
+}
@@ -0,0 +1,15 @@
+package appctl
+
+// deployment request passed to DeployAll and DeleteAll
+type Request struct {
+	// identifies the deployment, stamped onto applied objects
+	Id string
+	// env repo directory
+	Dir string
+	Rev string
+	// whether to deploy even if the deletion guard blocks
+	Force bool
+	// last successful request, groups failing verification are
+	// rolled back to it, nil if there is none
+	LastGood *Request
+}
@@ -0,0 +1,152 @@
+package appctl
+
+import (
+	"github.com/anliksim/bsc-deployer/appctl/kubectl"
+	"log"
+	"sync"
+)
+
+// outcome of a DeployAll or DeleteAll run, safe for concurrent use
+type Result struct {
+	Errors []error
+	// cloud-groups rolled back after failed verification
+	RolledBack []string
+	// workloads changed by the deployment and whether their rollout completed
+	Readiness []Readiness
+	// outcome per cloud of the deployment of the cloud-groups
+	Clouds []CloudResult
+	// placement decisions taken, e.g. failovers
+	Decisions []string
+	// shared with the results of the single cloud-groups
+	canaries *canaryOutcomes
+	lock     sync.Mutex
+}
+
+// canaries of a deployment by namespace/name of their Deployment, clouds
+// deploying the same Deployment concurrently wait for the first one's canary
+type canaryOutcomes struct {
+	lock sync.Mutex
+	runs map[string]*canaryRun
+}
+
+type canaryRun struct {
+	// closed once the outcome is known
+	done    chan struct{}
+	aborted bool
+}
+
+type Readiness struct {
+	Cloud     string
+	Group     string
+	Kind      string
+	Namespace string
+	Name      string
+	Ready     bool
+	// reason the workload is not ready
+	Error string
+}
+
+func newResult() *Result {
+	return &Result{canaries: &canaryOutcomes{runs: make(map[string]*canaryRun)}}
+}
+
+// result of a single cloud-group, merged into r once the group is done
+func (r *Result) forGroup() *Result {
+	return &Result{canaries: r.canaries}
+}
+
+func (r *Result) merge(group *Result) {
+	group.lock.Lock()
+	defer group.lock.Unlock()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Errors = append(r.Errors, group.Errors...)
+	r.RolledBack = append(r.RolledBack, group.RolledBack...)
+	r.Readiness = append(r.Readiness, group.Readiness...)
+}
+
+func (r *Result) setClouds(clouds []CloudResult) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Clouds = clouds
+}
+
+func (r *Result) addDecisions(decisions []string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, decision := range decisions {
+		log.Print(decision)
+		r.Decisions = append(r.Decisions, decision)
+	}
+}
+
+func (r *Result) Failed() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return len(r.Errors) > 0
+}
+
+func (r *Result) addError(err error) {
+	if err != nil {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		r.Errors = append(r.Errors, err)
+	}
+}
+
+func (r *Result) addErrors(errs []error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Errors = append(r.Errors, errs...)
+}
+
+// records the readiness of the rollouts, incomplete rollouts fail the deployment
+func (r *Result) addRollouts(c cloud, group string, rollouts []kubectl.Rollout) {
+	for _, rollout := range rollouts {
+		readiness := Readiness{
+			Cloud:     c.context,
+			Group:     group,
+			Kind:      rollout.Object.Kind,
+			Namespace: rollout.Object.Namespace,
+			Name:      rollout.Object.Name,
+			Ready:     rollout.Ready(),
+		}
+		if !rollout.Ready() {
+			readiness.Error = rollout.Err.Error()
+			r.addError(rollout.Err)
+		}
+		r.lock.Lock()
+		r.Readiness = append(r.Readiness, readiness)
+		r.lock.Unlock()
+	}
+}
+
+// the canary run of the deployment and whether the caller is
+// the first to claim it and thus has to finish it
+func (r *Result) claimCanary(key string) (*canaryRun, bool) {
+	r.canaries.lock.Lock()
+	defer r.canaries.lock.Unlock()
+	if run, ok := r.canaries.runs[key]; ok {
+		return run, false
+	}
+	run := &canaryRun{done: make(chan struct{})}
+	r.canaries.runs[key] = run
+	return run, true
+}
+
+// whether the canary of the deployment was aborted, waits for a canary in progress
+func (r *Result) canaryAborted(key string) bool {
+	r.canaries.lock.Lock()
+	run, ok := r.canaries.runs[key]
+	r.canaries.lock.Unlock()
+	if !ok {
+		return false
+	}
+	<-run.done
+	return run.aborted
+}
+
+func (run *canaryRun) finish(aborted bool) {
+	run.aborted = aborted
+	close(run.done)
+}
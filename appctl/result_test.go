@@ -0,0 +1,26 @@
+package appctl
+
+import (
+	"errors"
+	"github.com/anliksim/bsc-deployer/appctl/kubectl"
+	"github.com/anliksim/bsc-deployer/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAddRollouts(t *testing.T) {
+	result := newResult()
+	app := config.Object{Kind: "Deployment", Name: "rest-app", Namespace: "rest"}
+	db := config.Object{Kind: "StatefulSet", Name: "rest-db", Namespace: "rest"}
+
+	result.addRollouts(private, "rest", []kubectl.Rollout{
+		{Object: app},
+		{Object: db, Err: errors.New("timed out")},
+	})
+
+	assert.True(t, result.Failed())
+	assert.Equal(t, []Readiness{
+		{Cloud: privateContext, Group: "rest", Kind: "Deployment", Namespace: "rest", Name: "rest-app", Ready: true},
+		{Cloud: privateContext, Group: "rest", Kind: "StatefulSet", Namespace: "rest", Name: "rest-db", Error: "timed out"},
+	}, result.Readiness)
+}
@@ -0,0 +1,82 @@
+package appctl
+
+import (
+	"github.com/anliksim/bsc-deployer/appctl/kubectl"
+	"github.com/anliksim/bsc-deployer/config"
+	"log"
+	"time"
+)
+
+const revAnnotation = "deployer/rev"
+const deploymentIdAnnotation = "deployer/deployment-id"
+const appliedAtAnnotation = "deployer/applied-at"
+
+// revision of a cloud-group on a cloud, taken from
+// the most recently applied object of the group
+type Revision struct {
+	Rev          string
+	DeploymentId string
+	AppliedAt    string
+	// number of stamped objects of the group
+	Objects int
+	// whether the objects stem from different deployments
+	Mixed bool
+}
+
+// annotates the manifests with the request they are applied for
+func stamp(manifests []config.Object, request Request, appliedAt time.Time) ([]config.Object, error) {
+	annotations := map[string]string{
+		revAnnotation:          request.Rev,
+		deploymentIdAnnotation: request.Id,
+		appliedAtAnnotation:    appliedAt.UTC().Format(time.RFC3339),
+	}
+	stamped := make([]config.Object, len(manifests))
+	for i, manifest := range manifests {
+		var err error
+		if stamped[i], err = manifest.WithAnnotations(annotations); err != nil {
+			return nil, err
+		}
+	}
+	return stamped, nil
+}
+
+// reads the stamped revisions from the clusters as cloud -> cloud-group -> revision,
+// unreachable clouds are skipped
+func DeployedRevisions() map[string]map[string]*Revision {
+	revisions := make(map[string]map[string]*Revision)
+	for _, c := range clouds {
+		objects, err := kubectl.GetGroupObjects(c.context, groupLabel)
+		if err != nil {
+			log.Printf("Failed to read revisions from %s: %v", c.context, err)
+			continue
+		}
+		revisions[c.context] = groupRevisions(objects)
+	}
+	return revisions
+}
+
+func groupRevisions(objects []config.Object) map[string]*Revision {
+	revisions := make(map[string]*Revision)
+	for _, object := range objects {
+		rev, stamped := object.Annotations[revAnnotation]
+		if !stamped {
+			continue
+		}
+		group := object.Labels[groupLabel]
+		current := revisions[group]
+		if current == nil {
+			current = new(Revision)
+			revisions[group] = current
+		} else if current.DeploymentId != object.Annotations[deploymentIdAnnotation] {
+			current.Mixed = true
+		}
+		current.Objects++
+		// RFC3339 in UTC sorts lexicographically
+		if object.Annotations[appliedAtAnnotation] >= current.AppliedAt {
+			current.Rev = rev
+			current.DeploymentId = object.Annotations[deploymentIdAnnotation]
+			current.AppliedAt = object.Annotations[appliedAtAnnotation]
+		}
+	}
+	return revisions
+}
@@ -0,0 +1,70 @@
+package appctl
+
+import (
+	"github.com/anliksim/bsc-deployer/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func decodeObjects(t *testing.T, content string) []config.Object {
+	objects, err := config.DecodeObjects([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return objects
+}
+
+func TestStamp(t *testing.T) {
+	manifests := decodeObjects(t, `{"apiVersion": "v1", "kind": "ConfigMap",
+		"metadata": {"name": "rest-config", "annotations": {"note": "kept"}}}`)
+	appliedAt := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	stamped, err := stamp(manifests, Request{Id: "20200501-120000.000", Rev: "abc123"}, appliedAt)
+	assert.NoError(t, err)
+	if assert.Len(t, stamped, 1) {
+		assert.Equal(t, map[string]string{
+			"note":                   "kept",
+			"deployer/rev":           "abc123",
+			"deployer/deployment-id": "20200501-120000.000",
+			"deployer/applied-at":    "2020-05-01T12:00:00Z",
+		}, stamped[0].Annotations)
+		assert.Contains(t, string(stamped[0].Raw), "abc123")
+	}
+}
+
+func TestGroupRevisions_Latest(t *testing.T) {
+	objects := decodeObjects(t, `
+kind: Deployment
+metadata:
+  name: rest-app
+  labels: {cloud-group: rest}
+  annotations: {deployer/rev: v2, deployer/deployment-id: "2", deployer/applied-at: "2020-05-02T00:00:00Z"}
+---
+kind: Service
+metadata:
+  name: rest-service
+  labels: {cloud-group: rest}
+  annotations: {deployer/rev: v1, deployer/deployment-id: "1", deployer/applied-at: "2020-05-01T00:00:00Z"}
+---
+kind: Service
+metadata:
+  name: unstamped
+  labels: {cloud-group: rest}
+`)
+	revisions := groupRevisions(objects)
+	if assert.Contains(t, revisions, "rest") {
+		assert.Equal(t, &Revision{
+			Rev:          "v2",
+			DeploymentId: "2",
+			AppliedAt:    "2020-05-02T00:00:00Z",
+			Objects:      2,
+			Mixed:        true,
+		}, revisions["rest"])
+	}
+}
+
+func TestGroupRevisions_Unstamped(t *testing.T) {
+	objects := decodeObjects(t, `{"kind": "Service", "metadata": {"name": "rest", "labels": {"cloud-group": "rest"}}}`)
+	assert.Empty(t, groupRevisions(objects))
+}
@@ -0,0 +1,21 @@
+package sopsctl
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// decrypts a sops encrypted file, keys are picked up by sops itself,
+// e.g. age keys from SOPS_AGE_KEY_FILE
+func Decrypt(file string) ([]byte, error) {
+	cmd := exec.Command("sops", "--decrypt", file)
+	var outb, errb bytes.Buffer
+	cmd.Stdout = &outb
+	cmd.Stderr = &errb
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("sops --decrypt %s: %v: %s", file, err, strings.TrimSpace(errb.String()))
+	}
+	return outb.Bytes(), nil
+}
@@ -0,0 +1,154 @@
+package appctl
+
+import (
+	"fmt"
+	"github.com/anliksim/bsc-deployer/appctl/kubectl"
+	"github.com/anliksim/bsc-deployer/appctl/legacyctl"
+	"github.com/anliksim/bsc-deployer/config"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const kindDeployment = "Deployment"
+
+// cloud-group applied to a cloud by deployApps
+type placement struct {
+	cloud cloud
+	// cloud whose cloud-env label selected the objects
+	as      cloud
+	group   string
+	objects []config.Object
+}
+
+// groups whose rollouts did not complete and groups whose legacy processes are
+// not running within the timeout are rolled back to the last good request
+func verifyAndRollBack(request Request, placements []placement, legacy []config.Object, result *Result) {
+	log.Printf("Verifying deployment %s for up to %v...", request.Id, verifyTimeout)
+	failed := unreadyGroups(result)
+	for group, errs := range legacyctl.Verify(legacyClient, legacy, legacyPools, time.Now().Add(verifyTimeout)) {
+		failed[group] = true
+		result.addErrors(errs)
+	}
+	if len(failed) == 0 {
+		return
+	}
+	groups := make([]string, 0, len(failed))
+	for group := range failed {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	if request.LastGood == nil {
+		result.addError(fmt.Errorf("no successful deployment to roll back %s to", strings.Join(groups, ", ")))
+		return
+	}
+	log.Printf("Rolling back %s to %s...", strings.Join(groups, ", "), request.LastGood.Rev)
+	rollBack(request.Id, *request.LastGood, groups, placements, result)
+}
+
+// cloud-groups with rollouts that did not complete, the rollouts
+// were already waited for and their errors recorded when applied
+func unreadyGroups(result *Result) map[string]bool {
+	result.lock.Lock()
+	defer result.lock.Unlock()
+	failed := make(map[string]bool)
+	for _, readiness := range result.Readiness {
+		if !readiness.Ready {
+			failed[readiness.Group] = true
+		}
+	}
+	return failed
+}
+
+// re-applies the groups from the last good request to the clouds they
+// were placed on and to legacy hosts, objects the failed deployment
+// added to the groups are deleted
+func rollBack(failedId string, lastGood Request, groups []string, placements []placement, result *Result) {
+	manifests := make(map[string][]config.Object)
+	for _, p := range placements {
+		if !containsString(groups, p.group) {
+			continue
+		}
+		if _, loaded := manifests[p.cloud.context]; !loaded {
+			loadedManifests, err := loadManifests(lastGood, p.cloud.context)
+			if err != nil {
+				result.addError(fmt.Errorf("rollback failed: %v", err))
+				return
+			}
+			manifests[p.cloud.context] = loadedManifests
+		}
+		cgSelector := fmt.Sprintf(eqSelector, groupLabel, p.group)
+		selector := selectorString(cgSelector, p.as.selector())
+		changed, err := kubectl.ApplyWithSelector(p.cloud.context, manifests[p.cloud.context], selector)
+		result.addError(err)
+		result.addRollouts(p.cloud, p.group, kubectl.WaitForRollouts(p.cloud.context, changed, rolloutTimeout))
+		result.addError(deleteAdded(p.cloud, cgSelector, failedId, manifests[p.cloud.context], selector))
+	}
+	legacy, err := loadManifests(lastGood, legacyctl.Target)
+	if err != nil {
+		result.addError(fmt.Errorf("rollback failed: %v", err))
+		return
+	}
+	selected, err := config.SelectObjects(legacy, fmt.Sprintf("%s in (%s)", groupLabel, strings.Join(groups, ",")))
+	if err != nil {
+		result.addError(err)
+		return
+	}
+	result.addErrors(legacyctl.Apply(legacyClient, selected, legacyPools))
+	result.lock.Lock()
+	result.RolledBack = groups
+	result.lock.Unlock()
+}
+
+// deletes the objects of the group stamped with the failed deployment
+// id that are not part of the last good manifests matching the selector
+func deleteAdded(c cloud, cgSelector string, failedId string, lastGood []config.Object, selector string) error {
+	live, err := kubectl.GetGroupObjects(c.context, cgSelector)
+	if err != nil {
+		return fmt.Errorf("rollback failed to read %s on %s: %v", cgSelector, c.context, err)
+	}
+	previous, err := config.SelectObjects(lastGood, selector)
+	if err != nil {
+		return err
+	}
+	added := addedObjects(live, previous, failedId)
+	if len(added) == 0 {
+		return nil
+	}
+	log.Printf("Deleting %d objects added by %s from %s", len(added), failedId, c.context)
+	return kubectl.DeleteWithSelector(c.context, added, "")
+}
+
+// live objects stamped with the deployment id that have no
+// counterpart in the previous manifests
+func addedObjects(live []config.Object, previous []config.Object, deploymentId string) []config.Object {
+	var added []config.Object
+	for _, object := range live {
+		if object.Annotations[deploymentIdAnnotation] != deploymentId || containsObject(previous, object) {
+			continue
+		}
+		added = append(added, object)
+	}
+	return added
+}
+
+// manifests without namespace match the live object in any namespace
+func containsObject(manifests []config.Object, object config.Object) bool {
+	for _, m := range manifests {
+		if m.Kind == object.Kind && m.Name == object.Name &&
+			(m.Namespace == "" || m.Namespace == object.Namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, value string) bool {
+	for _, l := range list {
+		if l == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package appctl
+
+import (
+	"github.com/anliksim/bsc-deployer/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func stamped(kind string, name string, namespace string, deploymentId string) config.Object {
+	return config.Object{Kind: kind, Name: name, Namespace: namespace,
+		Annotations: map[string]string{deploymentIdAnnotation: deploymentId}}
+}
+
+func TestAddedObjects(t *testing.T) {
+	live := []config.Object{
+		stamped("Deployment", "rest-app", "rest", "2"),
+		stamped("Service", "rest-app", "rest", "2"),
+		stamped("ConfigMap", "rest-config", "rest", "2"),
+		stamped("ConfigMap", "rest-flags", "rest", "1"),
+	}
+	previous := []config.Object{
+		{Kind: "Deployment", Name: "rest-app", Namespace: "rest"},
+		{Kind: "Service", Name: "rest-app"},
+	}
+
+	// rest-flags was not applied by the failed deployment
+	assert.Equal(t, []config.Object{live[2]}, addedObjects(live, previous, "2"))
+	assert.Empty(t, addedObjects(live, previous, "3"))
+}
+
+func TestUnreadyGroups(t *testing.T) {
+	result := newResult()
+	result.Readiness = []Readiness{
+		{Cloud: "minikube", Group: "rest", Name: "rest-app", Ready: true},
+		{Cloud: "bsc-aks", Group: "rest", Name: "rest-app", Ready: false},
+		{Cloud: "minikube", Group: "monitoring", Name: "prometheus", Ready: true},
+	}
+
+	assert.Equal(t, map[string]bool{"rest": true}, unreadyGroups(result))
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"flag"
+	"github.com/anliksim/bsc-deployer/appctl/legacyctl"
+	"log"
+	"net/http"
+)
+
+// runs the in-memory legacy process api for local development,
+// point the legacy/host annotation to http://localhost:3558
+func main() {
+	addr := flag.String("addr", ":3558", "listen address")
+	flag.Parse()
+	log.Printf("Starting legacy stub at %s", *addr)
+	if err := http.ListenAndServe(*addr, legacyctl.NewStubServer()); err != nil {
+		log.Fatalf("Error starting legacy stub: %v", err)
+	}
+}
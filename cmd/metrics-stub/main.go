@@ -0,0 +1,20 @@
+package main
+
+import (
+	"flag"
+	"github.com/anliksim/bsc-deployer/appctl/metricsctl"
+	"log"
+	"net/http"
+)
+
+// runs a query api answering every query with the same value for local
+// development of canary deployments, point canary.prometheusUrl to http://localhost:3559
+func main() {
+	addr := flag.String("addr", ":3559", "listen address")
+	value := flag.Float64("value", 0, "value returned for every query")
+	flag.Parse()
+	log.Printf("Starting metrics stub at %s returning %v", *addr, *value)
+	if err := http.ListenAndServe(*addr, metricsctl.NewStubServer(*value)); err != nil {
+		log.Fatalf("Error starting metrics stub: %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const listKind = "List"
+
+// kubernetes object with the fields the deployer
+// dispatches on and its json representation
+type Object struct {
+	ApiVersion  string
+	Kind        string
+	Name        string
+	Namespace   string
+	Labels      map[string]string
+	Annotations map[string]string
+	// set by the server, bumped on changes of the spec only
+	Generation int64
+	// whether the object has owner references, e.g. the pods of a replica set
+	Owned bool
+	Raw   []byte
+}
+
+type objectHeader struct {
+	ApiVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string            `json:"name"`
+		Namespace       string            `json:"namespace"`
+		Labels          map[string]string `json:"labels"`
+		Annotations     map[string]string `json:"annotations"`
+		Generation      int64             `json:"generation"`
+		OwnerReferences []json.RawMessage `json:"ownerReferences"`
+	} `json:"metadata"`
+	// set for kind List only
+	Items []json.RawMessage `json:"items"`
+}
+
+// decodes json or multi document yaml, e.g. kubectl output, into objects,
+// items of kind List are flattened and empty documents are skipped
+func DecodeObjects(content []byte) ([]Object, error) {
+	var objects []Object
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(content), 4096)
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err == io.EOF {
+			return objects, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("error decoding objects: %v", err)
+		}
+		decoded, err := decodeObject(raw)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, decoded...)
+	}
+}
+
+func decodeObject(raw json.RawMessage) ([]Object, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+	header := new(objectHeader)
+	if err := json.Unmarshal(raw, header); err != nil {
+		return nil, fmt.Errorf("error decoding object: %v", err)
+	}
+	if header.Kind == listKind {
+		var objects []Object
+		for _, item := range header.Items {
+			decoded, err := decodeObject(item)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, decoded...)
+		}
+		return objects, nil
+	}
+	if header.Kind == "" {
+		return nil, fmt.Errorf("object without kind: %.80s", raw)
+	}
+	return []Object{{
+		ApiVersion:  header.ApiVersion,
+		Kind:        header.Kind,
+		Name:        header.Metadata.Name,
+		Namespace:   header.Metadata.Namespace,
+		Labels:      header.Metadata.Labels,
+		Annotations: header.Metadata.Annotations,
+		Generation:  header.Metadata.Generation,
+		Owned:       len(header.Metadata.OwnerReferences) > 0,
+		Raw:         raw,
+	}}, nil
+}
+
+// copy of the object with the labels merged into its metadata
+func (o Object) WithLabels(labels map[string]string) (Object, error) {
+	return o.withMetadata("labels", labels)
+}
+
+// copy of the object with the annotations merged into its metadata
+func (o Object) WithAnnotations(annotations map[string]string) (Object, error) {
+	return o.withMetadata("annotations", annotations)
+}
+
+// copy of the object with the namespace set in its metadata
+func (o Object) WithNamespace(namespace string) (Object, error) {
+	return o.editMetadata(func(metadata map[string]interface{}) {
+		metadata["namespace"] = namespace
+	})
+}
+
+func (o Object) withMetadata(field string, values map[string]string) (Object, error) {
+	if len(values) == 0 {
+		return o, nil
+	}
+	return o.editMetadata(func(metadata map[string]interface{}) {
+		existing, _ := metadata[field].(map[string]interface{})
+		if existing == nil {
+			existing = make(map[string]interface{})
+			metadata[field] = existing
+		}
+		for key, value := range values {
+			existing[key] = value
+		}
+	})
+}
+
+func (o Object) editMetadata(edit func(metadata map[string]interface{})) (Object, error) {
+	var content map[string]interface{}
+	if err := json.Unmarshal(o.Raw, &content); err != nil {
+		return o, fmt.Errorf("error decoding %s %s: %v", o.Kind, o.Name, err)
+	}
+	metadata, _ := content["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+		content["metadata"] = metadata
+	}
+	edit(metadata)
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return o, err
+	}
+	decoded, err := decodeObject(raw)
+	if err != nil {
+		return o, err
+	}
+	return decoded[0], nil
+}
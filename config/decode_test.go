@@ -0,0 +1,76 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const listJson = `{
+	"apiVersion": "v1",
+	"kind": "List",
+	"items": [
+		{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "ListService"}},
+		{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "rest-config", "namespace": "rest"}}
+	]
+}`
+
+const singleJson = `{
+	"apiVersion": "apps/v1",
+	"kind": "Deployment",
+	"metadata": {"name": "rest-app", "annotations": {"note": "List"}}
+}`
+
+const multiDocYaml = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: rest-app
+  labels:
+    cloud-group: rest
+---
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: rest-service
+`
+
+func TestDecodeObjects_List(t *testing.T) {
+	objects, err := DecodeObjects([]byte(listJson))
+	assert.NoError(t, err)
+	if assert.Len(t, objects, 2) {
+		assert.Equal(t, "ListService", objects[0].Name)
+		assert.Equal(t, "ConfigMap", objects[1].Kind)
+		assert.Equal(t, "rest", objects[1].Namespace)
+	}
+}
+
+func TestDecodeObjects_SingleNamedList(t *testing.T) {
+	objects, err := DecodeObjects([]byte(singleJson))
+	assert.NoError(t, err)
+	if assert.Len(t, objects, 1) {
+		assert.Equal(t, "Deployment", objects[0].Kind)
+		assert.JSONEq(t, singleJson, string(objects[0].Raw))
+	}
+}
+
+func TestDecodeObjects_Empty(t *testing.T) {
+	objects, err := DecodeObjects([]byte(""))
+	assert.NoError(t, err)
+	assert.Empty(t, objects)
+}
+
+func TestDecodeObjects_MultiDocYaml(t *testing.T) {
+	objects, err := DecodeObjects([]byte(multiDocYaml))
+	assert.NoError(t, err)
+	if assert.Len(t, objects, 2) {
+		assert.Equal(t, "rest", objects[0].Labels["cloud-group"])
+		assert.Equal(t, "Service", objects[1].Kind)
+		assert.JSONEq(t, `{"apiVersion":"v1","kind":"Service","metadata":{"name":"rest-service"}}`, string(objects[1].Raw))
+	}
+}
+
+func TestDecodeObjects_MissingKind(t *testing.T) {
+	_, err := DecodeObjects([]byte(`{"metadata": {"name": "rest-app"}}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// configuration of the deployer itself, as opposed
+// to the DeploymentData sent with each request
+type DeployerConfig struct {
+	Notifications NotificationConfig `json:"notifications"`
+	Legacy        LegacyConfig       `json:"legacy"`
+	History       HistoryConfig      `json:"history"`
+	Verification  VerificationConfig `json:"verification"`
+	Rollout       RolloutConfig      `json:"rollout"`
+	Progressive   ProgressiveConfig  `json:"progressive"`
+	Canary        CanaryConfig       `json:"canary"`
+	// number of cloud-groups deployed concurrently per cloud, default if zero
+	Parallelism int `json:"parallelism"`
+	// metadata of the clouds by kubectl context, used by placement policies
+	Clouds     map[string]CloudConfig `json:"clouds"`
+	Deletion   DeletionConfig         `json:"deletion"`
+	Placements PlacementsConfig       `json:"placements"`
+}
+
+type PlacementsConfig struct {
+	// directory the env repos given as ?dir= to GET /v1/placements are
+	// resolved in, ?dir= is rejected if empty
+	EnvRoot string `json:"envRoot"`
+}
+
+type DeletionConfig struct {
+	// objects a deployment may delete, unlimited if zero
+	MaxObjects int `json:"maxObjects"`
+	// objects a deployment may delete per cloud, unlimited if zero
+	MaxObjectsPerCloud int `json:"maxObjectsPerCloud"`
+	// whether blocked deployments wait for POST /v1/deployments/{id}/approve instead of failing
+	Approval bool `json:"approval"`
+	// time to wait for approval, default if zero
+	ApprovalTimeoutSeconds int `json:"approvalTimeoutSeconds"`
+}
+
+type CloudConfig struct {
+	// region the cloud runs in, matched against the regions of cpols
+	Region string `json:"region"`
+	// jurisdiction of the data stored in the cloud, matched against the residency of cpols
+	Residency string `json:"residency"`
+}
+
+type CanaryConfig struct {
+	// prometheus compatible query api, no canaries if empty
+	PrometheusUrl string `json:"prometheusUrl"`
+	// text/template of the query checked during the analysis, rendered with the
+	// .Name and .Namespace of the deployment and the .Canary deployment name
+	Query string `json:"query"`
+	// canaries are aborted once the query returns more than this
+	Threshold float64 `json:"threshold"`
+	// time the canary is analysed before promotion, default if zero
+	AnalysisSeconds int `json:"analysisSeconds"`
+	// time between queries, default if zero
+	IntervalSeconds int `json:"intervalSeconds"`
+}
+
+type ProgressiveConfig struct {
+	// whether groups placed on several clouds are deployed to the
+	// first cloud and promoted to the others once healthy
+	Enabled bool `json:"enabled"`
+	// time the first cloud has to stay healthy before promotion
+	BakeSeconds int `json:"bakeSeconds"`
+	// whether promotion waits for POST /v1/deployments/{id}/approve
+	Approval bool `json:"approval"`
+	// time to wait for approval, default if zero
+	ApprovalTimeoutSeconds int `json:"approvalTimeoutSeconds"`
+}
+
+type RolloutConfig struct {
+	// time to wait for the rollout of a changed workload, default if zero,
+	// overridden per workload by the deployer/rollout-timeout annotation
+	TimeoutSeconds int `json:"timeoutSeconds"`
+}
+
+type VerificationConfig struct {
+	// whether to verify deployments and roll back failing cloud-groups
+	Enabled bool `json:"enabled"`
+	// time for legacy processes to become healthy, default if zero,
+	// cloud rollouts are bounded by the rollout timeout
+	TimeoutSeconds int `json:"timeoutSeconds"`
+}
+
+type HistoryConfig struct {
+	// directory holding the deployment index and the env repo
+	// snapshots used for rollbacks, default if empty
+	SnapshotDir string `json:"snapshotDir"`
+	// number of snapshots kept, default if zero
+	Keep int `json:"keep"`
+}
+
+type LegacyConfig struct {
+	// request timeout towards legacy hosts, default if zero
+	TimeoutSeconds int `json:"timeoutSeconds"`
+	// number of retries of idempotent requests on 5xx and connection errors, default if nil
+	Retries *int `json:"retries"`
+	// hosts checked for orphaned processes in addition
+	// to the ones referenced by current descriptors
+	Hosts []string `json:"hosts"`
+	// named host lists referenced by the legacy/host-pool annotation
+	Pools map[string][]string `json:"pools"`
+}
+
+type NotificationConfig struct {
+	// key used to sign outgoing payloads, no signature if empty
+	Secret string `json:"secret"`
+	// number of retries after a failed delivery
+	Retries  int             `json:"retries"`
+	Webhooks []WebhookConfig `json:"webhooks"`
+}
+
+type WebhookConfig struct {
+	// slack or http
+	Type string `json:"type"`
+	Url  string `json:"url"`
+	// optional text/template for the message, slack only
+	Template string `json:"template"`
+}
+
+// loads the deployer config from the given file, falls
+// back to an empty config if the file does not exist
+func LoadDeployerConfig(filePath string) *DeployerConfig {
+	content, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		log.Printf("No deployer config found at %s, using defaults", filePath)
+		return new(DeployerConfig)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return ParseDeployerConfig(content)
+}
+
+func ParseDeployerConfig(jsonContent []byte) *DeployerConfig {
+	deployerConfig := new(DeployerConfig)
+	if err := json.Unmarshal(jsonContent, &deployerConfig); err != nil {
+		log.Fatal(err)
+	}
+	return deployerConfig
+}
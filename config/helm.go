@@ -0,0 +1,119 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"os"
+	"path/filepath"
+)
+
+const chartFile = "Chart.yaml"
+const chartDescriptorFile = "deployer.yaml"
+const targetValuesFile = "values-%s.yaml"
+
+// kinds without namespace, all others are placed in the namespace of the chart,
+// charts with custom cluster-scoped kinds list them in their descriptor
+var clusterScopedKinds = map[string]bool{
+	"Namespace":                      true,
+	"Node":                           true,
+	"ComponentStatus":                true,
+	"PersistentVolume":               true,
+	"StorageClass":                   true,
+	"VolumeAttachment":               true,
+	"CSINode":                        true,
+	"IngressClass":                   true,
+	"CertificateSigningRequest":      true,
+	"ClusterRole":                    true,
+	"ClusterRoleBinding":             true,
+	"CustomResourceDefinition":       true,
+	"PriorityClass":                  true,
+	"PodSecurityPolicy":              true,
+	"RuntimeClass":                   true,
+	"CSIDriver":                      true,
+	"APIService":                     true,
+	"MutatingWebhookConfiguration":   true,
+	"ValidatingWebhookConfiguration": true,
+}
+
+// helm chart below apps/ with the deployer.yaml descriptor
+// providing what plain manifests declare in their metadata
+type HelmChart struct {
+	Dir       string `json:"-"`
+	Release   string `json:"release"`
+	Namespace string `json:"namespace"`
+	// added to every rendered object, e.g. cloud-group
+	Labels map[string]string `json:"labels"`
+	// kinds of the chart that are cluster scoped in addition to clusterScopedKinds
+	ClusterScopedKinds []string `json:"clusterScopedKinds"`
+}
+
+func isHelmChart(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, chartFile))
+	return err == nil && !info.IsDir()
+}
+
+func LoadHelmChart(dir string) (*HelmChart, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dir, chartDescriptorFile))
+	if err != nil {
+		return nil, fmt.Errorf("chart %s requires a %s descriptor: %v", dir, chartDescriptorFile, err)
+	}
+	chart := &HelmChart{Dir: dir}
+	if err := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(content), 4096).Decode(chart); err != nil {
+		return nil, fmt.Errorf("invalid descriptor of chart %s: %v", dir, err)
+	}
+	if chart.Release == "" {
+		chart.Release = filepath.Base(dir)
+	}
+	return chart, nil
+}
+
+// values.yaml is used by helm anyway, values-<target>.yaml is added if present
+func (c *HelmChart) ValuesFiles(target string) []string {
+	var files []string
+	file := filepath.Join(c.Dir, fmt.Sprintf(targetValuesFile, target))
+	if _, err := os.Stat(file); err == nil {
+		files = append(files, file)
+	}
+	return files
+}
+
+func (c *HelmChart) clusterScoped(kind string) bool {
+	if clusterScopedKinds[kind] {
+		return true
+	}
+	for _, k := range c.ClusterScopedKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func renderHelmChart(dir string, target string, helm func(*HelmChart, []string) ([]byte, error)) ([]Object, error) {
+	chart, err := LoadHelmChart(dir)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := helm(chart, chart.ValuesFiles(target))
+	if err != nil {
+		return nil, fmt.Errorf("error rendering chart %s: %v", dir, err)
+	}
+	objects, err := DecodeObjects(rendered)
+	if err != nil {
+		return nil, fmt.Errorf("chart %s: %v", dir, err)
+	}
+	for i := range objects {
+		if objects[i], err = objects[i].WithLabels(chart.Labels); err != nil {
+			return nil, fmt.Errorf("chart %s: %v", dir, err)
+		}
+		// like helm install, which applies to the release namespace
+		if chart.Namespace != "" && objects[i].Namespace == "" && !chart.clusterScoped(objects[i].Kind) {
+			if objects[i], err = objects[i].WithNamespace(chart.Namespace); err != nil {
+				return nil, fmt.Errorf("chart %s: %v", dir, err)
+			}
+		}
+	}
+	return objects, nil
+}
@@ -2,8 +2,10 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	v1 "k8s.io/api/core/v1"
 	"log"
 )
@@ -11,12 +13,16 @@ import (
 type DeploymentData struct {
 	Dir string `json:"dir"`
 	Rev string `json:"rev"`
+	// optional url notified once the deployment finished
+	CallbackUrl string `json:"callbackUrl"`
+	// deploy even if more objects are deleted than the deletion guard allows
+	Force bool `json:"force"`
 }
 
-type NamedObject struct {
-	Metadata struct {
-		Name string `json:"name"`
-	} `json:"metadata"`
+// optional body of a rollback request
+type RollbackData struct {
+	// roll back even if more objects are deleted than the deletion guard allows
+	Force bool `json:"force"`
 }
 
 func UnmarshalFile(filePath string) *DeploymentData {
@@ -35,28 +41,34 @@ func ParseJson(jsonContent []byte) *DeploymentData {
 	return deployment
 }
 
-func ForEachItemInList(jsonContent []byte, deploymentHandler func([]byte)) {
-	list := new(v1.List)
-	if err := json.Unmarshal(jsonContent, &list); err != nil {
-		log.Fatalf("Error during unmarshal: %v", err)
+func JsonToDeployment(jsonContent []byte) (*appsv1.Deployment, error) {
+	deployment := new(appsv1.Deployment)
+	if err := json.Unmarshal(jsonContent, &deployment); err != nil {
+		return nil, fmt.Errorf("error during unmarshal: %v", err)
 	}
-	for _, c := range list.Items {
-		deploymentHandler(c.Raw)
+	return deployment, nil
+}
+
+func JsonToStatefulSet(jsonContent []byte) (*appsv1.StatefulSet, error) {
+	statefulSet := new(appsv1.StatefulSet)
+	if err := json.Unmarshal(jsonContent, &statefulSet); err != nil {
+		return nil, fmt.Errorf("error during unmarshal: %v", err)
 	}
+	return statefulSet, nil
 }
 
-func JsonToDeployment(jsonContent []byte) *appsv1.Deployment {
-	deployment := new(appsv1.Deployment)
-	if err := json.Unmarshal(jsonContent, &deployment); err != nil {
-		log.Fatalf("Error during unmarshal: %v", err)
+func JsonToCronJob(jsonContent []byte) (*batchv1beta1.CronJob, error) {
+	cronJob := new(batchv1beta1.CronJob)
+	if err := json.Unmarshal(jsonContent, &cronJob); err != nil {
+		return nil, fmt.Errorf("error during unmarshal: %v", err)
 	}
-	return deployment
+	return cronJob, nil
 }
 
-func JsonToNamedObject(jsonContent []byte) *NamedObject {
-	named := new(NamedObject)
-	if err := json.Unmarshal(jsonContent, &named); err != nil {
-		log.Fatalf("Error during unmarshal: %v", err)
+func JsonToConfigMap(jsonContent []byte) (*v1.ConfigMap, error) {
+	configMap := new(v1.ConfigMap)
+	if err := json.Unmarshal(jsonContent, &configMap); err != nil {
+		return nil, fmt.Errorf("error during unmarshal: %v", err)
 	}
-	return named
+	return configMap, nil
 }
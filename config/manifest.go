@@ -0,0 +1,160 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/labels"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// file extensions kubectl reads when given a directory
+var manifestExtensions = map[string]bool{
+	".json": true,
+	".yaml": true,
+	".yml":  true,
+}
+
+// kustomize reads the first of these files in a directory
+var kustomizationFiles = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+const kustomizeBase = "base"
+const kustomizeOverlays = "overlays"
+
+// renders app sources that are not plain manifests to yaml
+type Renderers struct {
+	// renders a kustomization directory, e.g. with kubectl kustomize
+	Kustomize func(dir string) ([]byte, error)
+	// renders a chart with the given values files, e.g. with helm template
+	Helm func(chart *HelmChart, valuesFiles []string) ([]byte, error)
+}
+
+// how manifests are loaded for a cloud or legacy
+type LoadOptions struct {
+	// cloud context or legacy, selects overlays and values files
+	Target    string
+	Renderers Renderers
+	// used to render *.tmpl manifests, templates fail if nil
+	Variables *Variables
+}
+
+// reads all manifests below dir like kubectl -f dir -R, without a cluster,
+// apps with a base kustomization are rendered from overlays/<target>
+// or from base if there is no overlay for the target, helm charts are
+// rendered with the values for the target, see LoadHelmChart, and
+// manifests ending in .tmpl are rendered with the variables
+func LoadManifests(dir string, options LoadOptions) ([]Object, error) {
+	target := options.Target
+	renderers := options.Renderers
+	var objects []Object
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && isKustomization(filepath.Join(path, kustomizeBase)) {
+			rendered, err := renderKustomization(path, target, renderers.Kustomize)
+			if err != nil {
+				return err
+			}
+			objects = append(objects, rendered...)
+			return filepath.SkipDir
+		}
+		if info.IsDir() && isHelmChart(path) {
+			rendered, err := renderHelmChart(path, target, renderers.Helm)
+			if err != nil {
+				return err
+			}
+			objects = append(objects, rendered...)
+			return filepath.SkipDir
+		}
+		if info.IsDir() {
+			return nil
+		}
+		var decoded []Object
+		if isTemplate(path) {
+			decoded, err = loadTemplateFile(path, target, options.Variables)
+		} else if manifestExtensions[filepath.Ext(path)] {
+			decoded, err = LoadManifestFile(path)
+		}
+		if err != nil {
+			return err
+		}
+		objects = append(objects, decoded...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error loading manifests from %s: %v", dir, err)
+	}
+	return objects, nil
+}
+
+func renderKustomization(appDir string, target string, kustomize func(string) ([]byte, error)) ([]Object, error) {
+	dir := filepath.Join(appDir, kustomizeOverlays, target)
+	if !isKustomization(dir) {
+		dir = filepath.Join(appDir, kustomizeBase)
+	}
+	rendered, err := kustomize(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering %s: %v", dir, err)
+	}
+	objects, err := DecodeObjects(rendered)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", dir, err)
+	}
+	return objects, nil
+}
+
+func isKustomization(dir string) bool {
+	for _, file := range kustomizationFiles {
+		if info, err := os.Stat(filepath.Join(dir, file)); err == nil && !info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+func LoadManifestFile(path string) ([]Object, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := DecodeObjects(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return objects, nil
+}
+
+// objects matching the label selector, same syntax as kubectl -l
+func SelectObjects(objects []Object, selector string) ([]Object, error) {
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %q: %v", selector, err)
+	}
+	var selected []Object
+	for _, object := range objects {
+		if parsed.Matches(labels.Set(object.Labels)) {
+			selected = append(selected, object)
+		}
+	}
+	return selected, nil
+}
+
+// encodes the objects as a single List accepted by kubectl -f -
+func EncodeList(objects []Object) []byte {
+	items := make([]json.RawMessage, len(objects))
+	for i, object := range objects {
+		items[i] = object.Raw
+	}
+	list, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       listKind,
+		"items":      items,
+	})
+	if err != nil {
+		log.Fatalf("Error marshalling list: %v", err)
+	}
+	return list
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const testEnvDir = "testdata"
+const testAppsDir = "testdata/apps"
+const testTemplatesDir = "testdata/templates"
+
+// renders a single deployment named after the rendered directory
+// or chart release and records the rendered directories and values
+func fakeRenderers(rendered *[]string) Renderers {
+	return Renderers{
+		Kustomize: func(dir string) ([]byte, error) {
+			*rendered = append(*rendered, dir)
+			return []byte(fmt.Sprintf("kind: Deployment\nmetadata:\n  name: %s\n", filepath.Base(dir))), nil
+		},
+		Helm: func(chart *HelmChart, valuesFiles []string) ([]byte, error) {
+			*rendered = append(*rendered, valuesFiles...)
+			return []byte(fmt.Sprintf("# Source: chart\n---\nkind: Deployment\nmetadata:\n  name: %s\n", chart.Release)), nil
+		},
+	}
+}
+
+// test secrets are stored in plain text
+func fakeDecrypt(file string) ([]byte, error) {
+	return ioutil.ReadFile(file)
+}
+
+func testOptions(t *testing.T, target string, rendered *[]string) LoadOptions {
+	variables, err := LoadVariables(testEnvDir, target, "ff755b0", fakeDecrypt)
+	assert.NoError(t, err)
+	return LoadOptions{Target: target, Renderers: fakeRenderers(rendered), Variables: variables}
+}
+
+func loadTestManifests(t *testing.T) []Object {
+	var rendered []string
+	objects, err := LoadManifests(testAppsDir, testOptions(t, "minikube", &rendered))
+	assert.NoError(t, err)
+	return objects
+}
+
+func names(objects []Object) []string {
+	var result []string
+	for _, object := range objects {
+		result = append(result, object.Name)
+	}
+	return result
+}
+
+func TestLoadManifests_Recursive(t *testing.T) {
+	objects := loadTestManifests(t)
+	assert.Equal(t, []string{"ingress", "legacy-app", "base", "rest-app", "rest-service"}, names(objects))
+}
+
+func TestLoadManifests_Overlay(t *testing.T) {
+	var rendered []string
+	_, err := LoadManifests(testAppsDir, testOptions(t, "bsc-aks", &rendered))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(testAppsDir, "ingress", "values-bsc-aks.yaml"),
+		filepath.Join(testAppsDir, "monitoring", "overlays", "bsc-aks"),
+	}, rendered)
+
+	rendered = nil
+	_, err = LoadManifests(testAppsDir, testOptions(t, "minikube", &rendered))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(testAppsDir, "monitoring", "base")}, rendered)
+}
+
+func TestLoadManifests_HelmChartLabels(t *testing.T) {
+	selected, err := SelectObjects(loadTestManifests(t), "cloud-group==ingress,cloud-env-bsc-aks==supported")
+	assert.NoError(t, err)
+	if assert.Len(t, selected, 1) {
+		assert.Equal(t, "ingress", selected[0].Name)
+		assert.Contains(t, string(selected[0].Raw), `"cloud-group":"ingress"`)
+		// namespace of the chart descriptor
+		assert.Equal(t, "ingress", selected[0].Namespace)
+	}
+}
+
+func TestLoadManifests_HelmChartClusterScoped(t *testing.T) {
+	helm := func(chart *HelmChart, valuesFiles []string) ([]byte, error) {
+		return []byte("kind: IngressClass\nmetadata:\n  name: nginx\n---\n" +
+			"kind: Deployment\nmetadata:\n  name: nginx-controller\n"), nil
+	}
+	objects, err := renderHelmChart(filepath.Join(testAppsDir, "ingress"), "minikube", helm)
+	assert.NoError(t, err)
+	if assert.Len(t, objects, 2) {
+		assert.Equal(t, "", objects[0].Namespace)
+		assert.Equal(t, "ingress", objects[1].Namespace)
+	}
+}
+
+func TestHelmChart_ClusterScopedKinds(t *testing.T) {
+	chart := &HelmChart{ClusterScopedKinds: []string{"ClusterIssuer"}}
+	assert.True(t, chart.clusterScoped("ClusterIssuer"))
+	assert.True(t, chart.clusterScoped("IngressClass"))
+	assert.False(t, chart.clusterScoped("Issuer"))
+}
+
+func TestSelectObjects(t *testing.T) {
+	objects := loadTestManifests(t)
+
+	selected, err := SelectObjects(objects, "cloud-legacy==supported")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"legacy-app"}, names(selected))
+
+	selected, err = SelectObjects(objects, "cloud-group==rest,cloud-env-bsc-aks!=supported")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rest-service"}, names(selected))
+
+	_, err = SelectObjects(objects, "cloud group")
+	assert.Error(t, err)
+}
+
+func TestEncodeList_RoundTrip(t *testing.T) {
+	objects := loadTestManifests(t)
+	decoded, err := DecodeObjects(EncodeList(objects))
+	assert.NoError(t, err)
+	assert.Equal(t, names(objects), names(decoded))
+}
+
+func TestLoadManifests_Template(t *testing.T) {
+	var rendered []string
+	selected, err := LoadManifests(testTemplatesDir, testOptions(t, "minikube", &rendered))
+	assert.NoError(t, err)
+	if assert.Len(t, selected, 1) {
+		assert.Equal(t, "rest-credentials", selected[0].Name)
+		assert.Equal(t, "ff755b0", selected[0].Annotations["rev"])
+		assert.Equal(t, "minikube", selected[0].Annotations["cloud"])
+		assert.Contains(t, string(selected[0].Raw), `"endpoint":"http://rest.minikube.local"`)
+		assert.Equal(t, `["rest-1","rest-2"]`, selected[0].Annotations["hosts"])
+		// quoted, so yaml special characters are kept as they are
+		assert.Contains(t, string(selected[0].Raw), `"password":"s3c: \"ret\" #1"`)
+	}
+}
+
+func TestLoadManifests_TemplateWithoutSecrets(t *testing.T) {
+	variables, err := LoadVariables(testEnvDir, "minikube", "ff755b0", nil)
+	assert.NoError(t, err)
+	selected, err := LoadManifests(testTemplatesDir, LoadOptions{Target: "minikube", Variables: variables})
+	assert.NoError(t, err)
+	if assert.Len(t, selected, 1) {
+		assert.Equal(t, "rest-credentials", selected[0].Name)
+		assert.Contains(t, string(selected[0].Raw), `"password":""`)
+	}
+}
+
+func TestLoadManifests_TemplateMissingVariable(t *testing.T) {
+	var rendered []string
+	// there are no variables and secrets for bsc-aks
+	_, err := LoadManifests(testTemplatesDir, testOptions(t, "bsc-aks", &rendered))
+	assert.Error(t, err)
+
+	_, err = LoadManifests(testTemplatesDir, LoadOptions{Target: "minikube"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+const templateExtension = ".tmpl"
+const varsFile = "vars/%s.yaml"
+const secretsFile = "secrets/%s.enc.yaml"
+
+// values available to *.tmpl manifests
+type Variables struct {
+	Rev  string
+	Vars map[string]interface{}
+	// decrypted key value pairs, only accessible through the secret function
+	secrets map[string]string
+	// secrets were not decrypted and render empty
+	withoutSecrets bool
+}
+
+// data passed to manifest templates, e.g. {{ .Rev }} or {{ .Cloud.Name }}
+type templateData struct {
+	Rev   string
+	Cloud struct {
+		Name string
+	}
+	Vars map[string]interface{}
+}
+
+// reads vars/<target>.yaml and the encrypted secrets/<target>.enc.yaml of
+// the env repo, both are optional, decrypt is only called if secrets exist.
+// Without decrypt secrets are not read at all and render as empty strings,
+// which is enough to find the objects to delete
+func LoadVariables(envDir string, target string, rev string, decrypt func(file string) ([]byte, error)) (*Variables, error) {
+	variables := &Variables{Rev: rev, Vars: make(map[string]interface{})}
+	if err := decodeOptionalFile(filepath.Join(envDir, fmt.Sprintf(varsFile, target)), nil, &variables.Vars); err != nil {
+		return nil, err
+	}
+	if decrypt == nil {
+		variables.withoutSecrets = true
+		return variables, nil
+	}
+	if err := decodeOptionalFile(filepath.Join(envDir, fmt.Sprintf(secretsFile, target)), decrypt, &variables.secrets); err != nil {
+		return nil, err
+	}
+	return variables, nil
+}
+
+func decodeOptionalFile(file string, decrypt func(string) ([]byte, error), into interface{}) error {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil
+	}
+	var content []byte
+	var err error
+	if decrypt != nil {
+		content, err = decrypt(file)
+	} else {
+		content, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", file, err)
+	}
+	if err := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(content), 4096).Decode(into); err != nil {
+		return fmt.Errorf("error decoding %s: %v", file, err)
+	}
+	return nil
+}
+
+// e.g. app.yaml.tmpl
+func isTemplate(path string) bool {
+	return filepath.Ext(path) == templateExtension &&
+		manifestExtensions[filepath.Ext(strings.TrimSuffix(path, templateExtension))]
+}
+
+func loadTemplateFile(path string, target string, variables *Variables) ([]Object, error) {
+	if variables == nil {
+		return nil, fmt.Errorf("%s: no variables to render template", path)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := variables.render(filepath.Base(path), content, target)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	objects, err := DecodeObjects(rendered)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return objects, nil
+}
+
+func (v *Variables) render(name string, content []byte, target string) ([]byte, error) {
+	t, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"secret": v.secret, "quote": quote, "toJson": toJson}).
+		Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+	data := templateData{Rev: v.Rev, Vars: v.Vars}
+	data.Cloud.Name = target
+	var rendered bytes.Buffer
+	if err := t.Execute(&rendered, data); err != nil {
+		return nil, err
+	}
+	return rendered.Bytes(), nil
+}
+
+// value as double quoted string, safe to paste into yaml whatever it contains
+func quote(value interface{}) (string, error) {
+	return toJson(fmt.Sprint(value))
+}
+
+// value as json, which yaml reads as a flow style value
+func toJson(value interface{}) (string, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+func (v *Variables) secret(key string) (string, error) {
+	if v.withoutSecrets {
+		return "", nil
+	}
+	value, ok := v.secrets[key]
+	if !ok {
+		return "", fmt.Errorf("unknown secret %q", key)
+	}
+	return value, nil
+}
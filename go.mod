@@ -7,6 +7,8 @@ require (
 	github.com/justinas/alice v1.2.0
 	github.com/nvellon/hal v0.3.0
 	github.com/prometheus/client_golang v1.6.0
-	github.com/stretchr/testify v1.4.0
+	github.com/stretchr/testify v1.5.1
+	helm.sh/helm/v3 v3.2.4
 	k8s.io/api v0.18.2
+	k8s.io/apimachinery v0.18.2
 )
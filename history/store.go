@@ -0,0 +1,254 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const StatusRunning = "running"
+const StatusSucceeded = "succeeded"
+const StatusFailed = "failed"
+
+// failed verification, the failing cloud-groups were rolled back
+const StatusRolledBack = "rolled-back"
+
+const ActionApply = "apply"
+const ActionDelete = "delete"
+const ActionRollback = "rollback"
+
+const DefaultKeep = 10
+
+// index of the deployments, kept next to the snapshots
+const indexFile = "deployments.json"
+
+var ErrNotFound = errors.New("deployment not found")
+
+// single deployment run and the inputs it was started with
+type Deployment struct {
+	Id     string `json:"id"`
+	Action string `json:"action"`
+	Rev    string `json:"rev"`
+	// env repo directory the deployment was requested for
+	Dir string `json:"dir"`
+	// copy of the env repo the deployment ran from, empty once pruned
+	Snapshot string `json:"snapshot,omitempty"`
+	// id of the deployment whose inputs were re-applied
+	RollbackOf string `json:"rollbackOf,omitempty"`
+	// whether the deletion guard is skipped
+	Force    bool      `json:"force,omitempty"`
+	Status   string    `json:"status"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished,omitempty"`
+	Errors   []string  `json:"errors,omitempty"`
+	// workloads changed by the deployment and whether their rollout completed
+	Readiness []Readiness `json:"readiness,omitempty"`
+	// outcome of the cloud-groups per cloud
+	Clouds []CloudSummary `json:"clouds,omitempty"`
+	// placement decisions taken, e.g. failovers to another cloud
+	Decisions []string `json:"decisions,omitempty"`
+}
+
+type CloudSummary struct {
+	Cloud    string   `json:"cloud"`
+	Deployed []string `json:"deployed,omitempty"`
+	Failed   []string `json:"failed,omitempty"`
+	Skipped  []string `json:"skipped,omitempty"`
+	// time spent deploying to the cloud
+	Seconds float64 `json:"seconds"`
+}
+
+type Readiness struct {
+	Cloud     string `json:"cloud"`
+	Group     string `json:"group"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Ready     bool   `json:"ready"`
+	Error     string `json:"error,omitempty"`
+}
+
+// deployments can be rolled back to if they succeeded with a snapshot
+func (d Deployment) Rollbackable() bool {
+	return d.Status == StatusSucceeded && d.Action != ActionDelete && d.Snapshot != ""
+}
+
+// deployment history persisted in dir, keeps the snapshots
+// of the most recent deployments only
+type Store struct {
+	mu          sync.Mutex
+	dir         string
+	keep        int
+	deployments []*Deployment
+}
+
+// opens the store in dir, deployments still running
+// according to the index are marked as failed
+func NewStore(dir string, keep int) (*Store, error) {
+	if keep < 1 {
+		keep = DefaultKeep
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, keep: keep}
+	content, err := ioutil.ReadFile(s.indexPath())
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &s.deployments); err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", s.indexPath(), err)
+	}
+	for _, d := range s.deployments {
+		if d.Status == StatusRunning {
+			d.Status = StatusFailed
+			d.Errors = append(d.Errors, "interrupted by deployer restart")
+		}
+	}
+	return s, nil
+}
+
+// records a new deployment
+func (s *Store) Add(d Deployment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d.Status == "" {
+		d.Status = StatusRunning
+	}
+	s.deployments = append(s.deployments, &d)
+	s.save()
+}
+
+func (s *Store) Get(id string) (Deployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d := s.find(id); d != nil {
+		return *d, nil
+	}
+	return Deployment{}, ErrNotFound
+}
+
+// all deployments, oldest first
+func (s *Store) List() []Deployment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Deployment, len(s.deployments))
+	for i, d := range s.deployments {
+		list[i] = *d
+	}
+	return list
+}
+
+// outcome of a deployment recorded by Finish
+type Outcome struct {
+	Status    string
+	Finished  time.Time
+	Errors    []string
+	Readiness []Readiness
+	Clouds    []CloudSummary
+	Decisions []string
+}
+
+// records the outcome of the deployment
+func (s *Store) Finish(id string, outcome Outcome) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.find(id)
+	if d == nil {
+		log.Printf("Finished unknown deployment %s", id)
+		return
+	}
+	d.Status = outcome.Status
+	d.Finished = outcome.Finished
+	d.Errors = outcome.Errors
+	d.Readiness = outcome.Readiness
+	d.Clouds = outcome.Clouds
+	d.Decisions = outcome.Decisions
+	s.save()
+}
+
+// copies the env repo of the deployment into the store and
+// returns the copy, older snapshots beyond keep are removed
+func (s *Store) Snapshot(id string) (string, error) {
+	s.mu.Lock()
+	d := s.find(id)
+	s.mu.Unlock()
+	if d == nil {
+		return "", ErrNotFound
+	}
+	snapshot := filepath.Join(s.dir, id)
+	if err := copyDir(d.Dir, snapshot); err != nil {
+		_ = os.RemoveAll(snapshot)
+		return "", fmt.Errorf("error taking snapshot of %s: %v", d.Dir, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d.Snapshot = snapshot
+	s.prune()
+	s.save()
+	return snapshot, nil
+}
+
+// most recent deployment that can be rolled back to
+func (s *Store) LastGood() (Deployment, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.deployments) - 1; i >= 0; i-- {
+		if d := s.deployments[i]; d.Rollbackable() {
+			return *d, true
+		}
+	}
+	return Deployment{}, false
+}
+
+func (s *Store) find(id string) *Deployment {
+	for _, d := range s.deployments {
+		if d.Id == id {
+			return d
+		}
+	}
+	return nil
+}
+
+// removes all but the most recent snapshots
+func (s *Store) prune() {
+	kept := 0
+	for i := len(s.deployments) - 1; i >= 0; i-- {
+		d := s.deployments[i]
+		if d.Snapshot == "" {
+			continue
+		}
+		if kept < s.keep {
+			kept++
+			continue
+		}
+		if err := os.RemoveAll(d.Snapshot); err != nil {
+			log.Printf("Failed to remove snapshot %s: %v", d.Snapshot, err)
+			continue
+		}
+		d.Snapshot = ""
+	}
+}
+
+func (s *Store) save() {
+	content, err := json.MarshalIndent(s.deployments, "", "  ")
+	if err != nil {
+		log.Fatalf("Error marshalling deployments: %v", err)
+	}
+	if err := ioutil.WriteFile(s.indexPath(), content, 0644); err != nil {
+		log.Printf("Failed to save deployments: %v", err)
+	}
+}
+
+func (s *Store) indexPath() string {
+	return filepath.Join(s.dir, indexFile)
+}
@@ -0,0 +1,149 @@
+package history
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// temporary directory, removed by calling the returned func
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { _ = os.RemoveAll(dir) }
+}
+
+func testEnvDir(t *testing.T) (string, func()) {
+	dir, cleanup := tempDir(t)
+	files := map[string]string{
+		"apps/rest/rest.yaml":            "kind: Deployment",
+		"policies/definitions/rest.yaml": "kind: CloudPolicy",
+		".git/HEAD":                      "ref: refs/heads/master",
+	}
+	for file, content := range files {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, cleanup
+}
+
+func TestSnapshot_CopiesEnvRepo(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	s, err := NewStore(dir, 0)
+	assert.NoError(t, err)
+	env, cleanupEnv := testEnvDir(t)
+	defer cleanupEnv()
+	s.Add(Deployment{Id: "1", Action: ActionApply, Dir: env})
+
+	snapshot, err := s.Snapshot("1")
+	assert.NoError(t, err)
+	content, err := ioutil.ReadFile(filepath.Join(snapshot, "policies/definitions/rest.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "kind: CloudPolicy", string(content))
+	_, err = os.Stat(filepath.Join(snapshot, ".git"))
+	assert.True(t, os.IsNotExist(err))
+
+	d, _ := s.Get("1")
+	assert.Equal(t, snapshot, d.Snapshot)
+}
+
+func TestSnapshot_PrunesOldest(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	s, err := NewStore(dir, 2)
+	assert.NoError(t, err)
+	env, cleanupEnv := testEnvDir(t)
+	defer cleanupEnv()
+	var snapshots []string
+	for _, id := range []string{"1", "2", "3"} {
+		s.Add(Deployment{Id: id, Action: ActionApply, Dir: env})
+		snapshot, err := s.Snapshot(id)
+		assert.NoError(t, err)
+		snapshots = append(snapshots, snapshot)
+	}
+
+	_, err = os.Stat(snapshots[0])
+	assert.True(t, os.IsNotExist(err))
+	assert.DirExists(t, snapshots[1])
+	assert.DirExists(t, snapshots[2])
+	d, _ := s.Get("1")
+	assert.Empty(t, d.Snapshot)
+}
+
+func TestStore_Finish(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	s, err := NewStore(dir, 0)
+	assert.NoError(t, err)
+	s.Add(Deployment{Id: "1", Action: ActionApply, Snapshot: "snapshots/1"})
+	s.Add(Deployment{Id: "2", Action: ActionApply, Snapshot: "snapshots/2"})
+
+	s.Finish("1", Outcome{Status: StatusSucceeded, Finished: time.Now()})
+	s.Finish("2", Outcome{Status: StatusFailed, Finished: time.Now(), Errors: []string{"kubectl apply failed"}})
+
+	succeeded, _ := s.Get("1")
+	failed, _ := s.Get("2")
+	assert.Equal(t, StatusSucceeded, succeeded.Status)
+	assert.True(t, succeeded.Rollbackable())
+	assert.Equal(t, StatusFailed, failed.Status)
+	assert.False(t, failed.Rollbackable())
+}
+
+func TestStore_LastGood(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	s, err := NewStore(dir, 0)
+	assert.NoError(t, err)
+	_, found := s.LastGood()
+	assert.False(t, found)
+
+	s.Add(Deployment{Id: "1", Action: ActionApply, Snapshot: "snapshots/1"})
+	s.Add(Deployment{Id: "2", Action: ActionApply, Snapshot: "snapshots/2"})
+	s.Add(Deployment{Id: "3", Action: ActionApply, Snapshot: "snapshots/3"})
+	s.Finish("1", Outcome{Status: StatusSucceeded, Finished: time.Now()})
+	s.Finish("2", Outcome{Status: StatusSucceeded, Finished: time.Now()})
+	s.Finish("3", Outcome{Status: StatusRolledBack, Finished: time.Now(), Errors: []string{"deployment/rest-app unavailable"}})
+
+	lastGood, found := s.LastGood()
+	assert.True(t, found)
+	assert.Equal(t, "2", lastGood.Id)
+}
+
+func TestStore_NotFound(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	s, err := NewStore(dir, 0)
+	assert.NoError(t, err)
+	_, err = s.Get("unknown")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestNewStore_ReloadsIndex(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	s, err := NewStore(dir, 0)
+	assert.NoError(t, err)
+	s.Add(Deployment{Id: "1", Action: ActionApply})
+	s.Add(Deployment{Id: "2", Action: ActionApply})
+	s.Finish("1", Outcome{Status: StatusSucceeded, Finished: time.Now()})
+
+	reloaded, err := NewStore(dir, 0)
+	assert.NoError(t, err)
+	list := reloaded.List()
+	if assert.Len(t, list, 2) {
+		assert.Equal(t, StatusSucceeded, list[0].Status)
+		// still running when the deployer stopped
+		assert.Equal(t, StatusFailed, list[1].Status)
+	}
+}
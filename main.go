@@ -3,29 +3,43 @@ package main
 import (
 	"github.com/anliksim/bsc-deployer/api"
 	apiv1 "github.com/anliksim/bsc-deployer/api/v1"
+	"github.com/anliksim/bsc-deployer/appctl"
+	"github.com/anliksim/bsc-deployer/config"
 	"github.com/gorilla/mux"
 	"github.com/justinas/alice"
 	"log"
 	"net/http"
+	"os"
 	"time"
 )
 
 const version = "v0.8"
 const port = ":3557"
 const baseUrl = "http://localhost" + port
+const defaultConfigFile = "deployer.json"
 
 func main() {
+	deployerConfig := config.LoadDeployerConfig(configFile())
+	appctl.Configure(deployerConfig)
 	errorChain := alice.New(loggerHandler, recoverHandler)
 	r := mux.NewRouter()
 	http.Handle(api.Base, errorChain.Then(r))
 	api.Register(r, baseUrl)
-	apiv1.Register(r, baseUrl)
+	apiv1.Register(r, baseUrl, deployerConfig)
 	log.Printf("Starting server %s at %s", version, baseUrl)
 	if err := http.ListenAndServe(port, nil); err != nil {
 		log.Fatalf("Error starting deployer: %v", err)
 	}
 }
 
+// config file can be overridden with DEPLOYER_CONFIG
+func configFile() string {
+	if file, ok := os.LookupEnv("DEPLOYER_CONFIG"); ok {
+		return file
+	}
+	return defaultConfigFile
+}
+
 func loggerHandler(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf(">> %s %s", r.Method, r.URL.Path)
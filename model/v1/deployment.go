@@ -1,13 +1,14 @@
 package v1
 
 import (
+	"github.com/anliksim/bsc-deployer/history"
 	"github.com/nvellon/hal"
-	"strings"
-	"time"
 )
 
 type Deployments struct {
-	Entries map[time.Time]string
+	Entries []history.Deployment
+	// ids of running deployments waiting at the promotion gate
+	AwaitingApproval map[string]bool
 }
 
 func (p Deployments) GetMap() hal.Entry {
@@ -16,29 +17,39 @@ func (p Deployments) GetMap() hal.Entry {
 	}
 }
 
-func deploymentsAsString(deployments *Deployments) string {
-	var str strings.Builder
-	dl := " scheduled at "
-	for key, value := range deployments.Entries {
-		str.WriteString(value)
-		str.WriteString(dl)
-		str.WriteString(key.String())
-		str.WriteRune('\n')
-	}
-	return str.String()
-}
-
-func deploymentsAsArray(deployments *Deployments) []string {
-	output := make([]string, len(deployments.Entries))
-	dl := " scheduled at "
-	i := 0
-	for key, value := range deployments.Entries {
-		var str strings.Builder
-		str.WriteString(value)
-		str.WriteString(dl)
-		str.WriteString(key.Format("2006-01-02 15:04:05"))
-		output[i] = str.String()
-		i = i + 1
+func deploymentsAsArray(deployments *Deployments) []map[string]interface{} {
+	output := make([]map[string]interface{}, len(deployments.Entries))
+	for i, d := range deployments.Entries {
+		entry := map[string]interface{}{
+			"id":           d.Id,
+			"action":       d.Action,
+			"rev":          d.Rev,
+			"status":       d.Status,
+			"started":      d.Started.Format("2006-01-02 15:04:05"),
+			"rollbackable": d.Rollbackable(),
+		}
+		if !d.Finished.IsZero() {
+			entry["finished"] = d.Finished.Format("2006-01-02 15:04:05")
+		}
+		if d.RollbackOf != "" {
+			entry["rollbackOf"] = d.RollbackOf
+		}
+		if len(d.Errors) > 0 {
+			entry["errors"] = d.Errors
+		}
+		if deployments.AwaitingApproval[d.Id] {
+			entry["awaitingApproval"] = true
+		}
+		if len(d.Clouds) > 0 {
+			entry["clouds"] = d.Clouds
+		}
+		if len(d.Readiness) > 0 {
+			entry["readiness"] = d.Readiness
+		}
+		if len(d.Decisions) > 0 {
+			entry["decisions"] = d.Decisions
+		}
+		output[i] = entry
 	}
 	return output
 }
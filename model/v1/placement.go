@@ -0,0 +1,80 @@
+package v1
+
+import (
+	"github.com/anliksim/bsc-deployer/policy"
+	"github.com/nvellon/hal"
+)
+
+type GroupPlacement struct {
+	Group   string
+	Cpols   []string
+	Policy  policy.Policy
+	Targets []string
+	Reasons []string
+	Errors  []string
+	Clouds  []CloudSelectors
+}
+
+type CloudSelectors struct {
+	Cloud  string
+	Action string
+	Apply  string
+	Delete string
+}
+
+type Placements struct {
+	Groups []GroupPlacement
+	// env repo the policies were read from, the cluster if empty
+	Dir string
+}
+
+func (p Placements) GetMap() hal.Entry {
+	groups := make([]map[string]interface{}, len(p.Groups))
+	for i, g := range p.Groups {
+		groups[i] = placementAsMap(g)
+	}
+	entry := hal.Entry{
+		"placements": groups,
+	}
+	if p.Dir != "" {
+		entry["dir"] = p.Dir
+	}
+	return entry
+}
+
+type Placement struct {
+	Group GroupPlacement
+}
+
+func (p Placement) GetMap() hal.Entry {
+	return hal.Entry(placementAsMap(p.Group))
+}
+
+func placementAsMap(g GroupPlacement) map[string]interface{} {
+	clouds := make([]map[string]interface{}, len(g.Clouds))
+	for i, c := range g.Clouds {
+		cloud := map[string]interface{}{
+			"cloud":  c.Cloud,
+			"action": c.Action,
+		}
+		if c.Apply != "" {
+			cloud["apply"] = c.Apply
+		}
+		if c.Delete != "" {
+			cloud["delete"] = c.Delete
+		}
+		clouds[i] = cloud
+	}
+	entry := map[string]interface{}{
+		"group":   g.Group,
+		"cpols":   g.Cpols,
+		"policy":  g.Policy,
+		"targets": g.Targets,
+		"reasons": g.Reasons,
+		"clouds":  clouds,
+	}
+	if len(g.Errors) > 0 {
+		entry["errors"] = g.Errors
+	}
+	return entry
+}
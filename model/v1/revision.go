@@ -0,0 +1,36 @@
+package v1
+
+import "github.com/nvellon/hal"
+
+type Revision struct {
+	Rev          string
+	DeploymentId string
+	AppliedAt    string
+	Objects      int
+	Mixed        bool
+}
+
+type Revisions struct {
+	// cloud -> cloud-group -> revision
+	Clouds map[string]map[string]Revision
+}
+
+func (p Revisions) GetMap() hal.Entry {
+	clouds := make(map[string]interface{})
+	for cloud, groups := range p.Clouds {
+		entries := make(map[string]interface{})
+		for group, revision := range groups {
+			entries[group] = map[string]interface{}{
+				"rev":          revision.Rev,
+				"deploymentId": revision.DeploymentId,
+				"appliedAt":    revision.AppliedAt,
+				"objects":      revision.Objects,
+				"mixed":        revision.Mixed,
+			}
+		}
+		clouds[cloud] = entries
+	}
+	return hal.Entry{
+		"clouds": clouds,
+	}
+}
@@ -0,0 +1,144 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/anliksim/bsc-deployer/config"
+	"log"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+const SignatureHeader = "X-Deployer-Signature"
+
+const slackType = "slack"
+const defaultTemplate = "Deployment {{.Id}} ({{.Action}} {{.Rev}}) {{.Status}} after {{.Duration}}"
+
+// payload sent to callbacks after a deployment finished
+type Event struct {
+	Id       string    `json:"id"`
+	Action   string    `json:"action"`
+	Rev      string    `json:"rev"`
+	Status   string    `json:"status"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Errors   []string  `json:"errors,omitempty"`
+}
+
+func (e Event) Duration() time.Duration {
+	return e.Finished.Sub(e.Started).Round(time.Second)
+}
+
+type Notifier struct {
+	config  config.NotificationConfig
+	client  *http.Client
+	backoff time.Duration
+}
+
+func New(notificationConfig config.NotificationConfig) *Notifier {
+	return &Notifier{
+		config:  notificationConfig,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		backoff: time.Second,
+	}
+}
+
+// sends the event to all configured webhooks and the optional
+// callback url of the deployment request, errors are logged only
+func (n *Notifier) Send(event Event, callbackUrl string) {
+	for _, hook := range n.config.Webhooks {
+		if err := n.sendTo(hook, event); err != nil {
+			log.Printf("Failed to notify %s: %v", hook.Url, err)
+		}
+	}
+	if callbackUrl != "" {
+		if err := n.sendTo(config.WebhookConfig{Url: callbackUrl}, event); err != nil {
+			log.Printf("Failed to notify %s: %v", callbackUrl, err)
+		}
+	}
+}
+
+func (n *Notifier) sendTo(hook config.WebhookConfig, event Event) error {
+	payload, err := payloadFor(hook, event)
+	if err != nil {
+		return err
+	}
+	return n.post(hook.Url, payload)
+}
+
+func payloadFor(hook config.WebhookConfig, event Event) ([]byte, error) {
+	if hook.Type != slackType {
+		return json.Marshal(event)
+	}
+	text, err := render(hook.Template, event)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]string{"text": text})
+}
+
+func render(tmpl string, event Event) (string, error) {
+	if tmpl == "" {
+		tmpl = defaultTemplate
+	}
+	t, err := template.New("message").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid template: %v", err)
+	}
+	var message bytes.Buffer
+	if err := t.Execute(&message, event); err != nil {
+		return "", fmt.Errorf("error rendering template: %v", err)
+	}
+	return message.String(), nil
+}
+
+// posts the payload and retries on connection errors and 5xx responses
+func (n *Notifier) post(url string, payload []byte) error {
+	var err error
+	for attempt := 0; attempt <= n.config.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(n.backoff * time.Duration(1<<uint(attempt-1)))
+		}
+		if err = n.postOnce(url, payload); err == nil {
+			return nil
+		}
+		log.Printf("Notification attempt %d to %s failed: %v", attempt+1, url, err)
+	}
+	return err
+}
+
+func (n *Notifier) postOnce(url string, payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.config.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(n.config.Secret, payload))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("server responded with %s", resp.Status)
+	}
+	if resp.StatusCode >= 400 {
+		// client errors are not retried
+		log.Printf("Notification to %s rejected with %s", url, resp.Status)
+	}
+	return nil
+}
+
+// hex encoded HMAC-SHA256 of the payload, prefixed with the algorithm
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"encoding/json"
+	"github.com/anliksim/bsc-deployer/config"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testEvent = Event{
+	Id:       "20200501-120000.000",
+	Action:   "apply",
+	Rev:      "ff755b0",
+	Status:   "succeeded",
+	Started:  time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC),
+	Finished: time.Date(2020, 5, 1, 12, 1, 30, 0, time.UTC),
+}
+
+func TestSend_SlackMessage(t *testing.T) {
+	var received map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &received)
+	}))
+	defer server.Close()
+
+	n := New(config.NotificationConfig{
+		Webhooks: []config.WebhookConfig{{Type: "slack", Url: server.URL}},
+	})
+	n.Send(testEvent, "")
+	assert.Equal(t, "Deployment 20200501-120000.000 (apply ff755b0) succeeded after 1m30s", received["text"])
+}
+
+func TestSend_SignedCallback(t *testing.T) {
+	var signature string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(SignatureHeader)
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	n := New(config.NotificationConfig{Secret: "s3cret"})
+	n.Send(testEvent, server.URL)
+	assert.Equal(t, Sign("s3cret", body), signature)
+
+	event := new(Event)
+	assert.NoError(t, json.Unmarshal(body, event))
+	assert.Equal(t, testEvent.Rev, event.Rev)
+}
+
+func TestSend_RetriesOnServerError(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	n := New(config.NotificationConfig{Retries: 3})
+	n.backoff = time.Millisecond
+	n.Send(testEvent, server.URL)
+	assert.Equal(t, 3, calls)
+}
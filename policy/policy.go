@@ -0,0 +1,220 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+)
+
+const cloudEnvLabel = "cloud-env-"
+
+// cloud a policy is evaluated against, named by its kubectl context
+type Cloud struct {
+	Name string
+	// region the cloud runs in, e.g. switzerlandnorth
+	Region string
+	// jurisdiction data stored in the cloud is subject to, e.g. ch
+	Residency string
+}
+
+// placement constraints of a cloud-group as declared in the spec of its cpols
+type Policy struct {
+	// cloud-env-<cloud> labels of the clouds supported by the group, same as required
+	Labels []string `json:"labels"`
+	// clouds the group must be deployed to
+	Required []string `json:"required"`
+	// clouds the group is deployed to if allowed by the other constraints
+	Preferred []string `json:"preferred"`
+	// number of clouds the group is deployed to at least, filled up with eligible clouds
+	MinClouds int `json:"minClouds"`
+	// number of clouds the group is deployed to at most, unlimited if zero
+	MaxClouds int `json:"maxClouds"`
+	// regions of the eligible clouds, any if nil
+	Regions []string `json:"regions"`
+	// residencies of the eligible clouds, any if nil
+	Residency []string `json:"residency"`
+}
+
+// target clouds of a policy and the reasons they were chosen
+type Decision struct {
+	Targets  []string
+	Eligible []string
+	Reasons  []string
+}
+
+// combines the policies of several cpols of a group, clouds add up while the
+// restrictions of all policies apply, empty restrictions are ignored
+func Merge(policies ...Policy) Policy {
+	var merged Policy
+	for i, p := range policies {
+		merged.Labels = append(merged.Labels, p.Labels...)
+		merged.Required = append(merged.Required, p.Required...)
+		merged.Preferred = append(merged.Preferred, p.Preferred...)
+		if p.MinClouds > merged.MinClouds {
+			merged.MinClouds = p.MinClouds
+		}
+		if p.MaxClouds > 0 && (merged.MaxClouds == 0 || p.MaxClouds < merged.MaxClouds) {
+			merged.MaxClouds = p.MaxClouds
+		}
+		if i == 0 {
+			merged.Regions, merged.Residency = orNil(p.Regions), orNil(p.Residency)
+			continue
+		}
+		merged.Regions = restrict(merged.Regions, p.Regions)
+		merged.Residency = restrict(merged.Residency, p.Residency)
+	}
+	return merged
+}
+
+// values allowed by both lists, where a nil list allows any value
+func restrict(allowed []string, other []string) []string {
+	if allowed == nil {
+		return orNil(other)
+	}
+	if len(other) == 0 {
+		return allowed
+	}
+	// not nil if there are no common values, so no value is allowed
+	both := []string{}
+	for _, value := range allowed {
+		if contains(other, value) {
+			both = append(both, value)
+		}
+	}
+	return both
+}
+
+// computes the clouds the policy places its group on, in the order of the clouds,
+// fails if the constraints cannot be satisfied
+func Evaluate(p Policy, clouds []Cloud) (Decision, error) {
+	var decision Decision
+	reason := func(format string, a ...interface{}) {
+		decision.Reasons = append(decision.Reasons, fmt.Sprintf(format, a...))
+	}
+
+	excluded := make(map[string]string)
+	for _, c := range clouds {
+		if why := exclusion(p, c); why != "" {
+			excluded[c.Name] = why
+			reason("%s excluded, %s", c.Name, why)
+			continue
+		}
+		decision.Eligible = append(decision.Eligible, c.Name)
+	}
+
+	placed := make(map[string]bool)
+	for _, name := range required(p, clouds) {
+		if placed[name] {
+			continue
+		}
+		if !known(clouds, name) {
+			return decision, fmt.Errorf("required cloud %s is unknown", name)
+		}
+		if why, ok := excluded[name]; ok {
+			return decision, fmt.Errorf("required cloud %s is excluded, %s", name, why)
+		}
+		placed[name] = true
+		reason("%s required", name)
+	}
+	if p.MaxClouds > 0 && len(placed) > p.MaxClouds {
+		return decision, fmt.Errorf("%d clouds required but at most %d allowed", len(placed), p.MaxClouds)
+	}
+
+	for _, name := range p.Preferred {
+		switch {
+		case placed[name]:
+		case !known(clouds, name):
+			reason("%s preferred but unknown", name)
+		case excluded[name] != "":
+			reason("%s preferred but excluded", name)
+		case p.MaxClouds > 0 && len(placed) >= p.MaxClouds:
+			reason("%s preferred but at most %d clouds allowed", name, p.MaxClouds)
+		default:
+			placed[name] = true
+			reason("%s preferred", name)
+		}
+	}
+
+	for _, name := range decision.Eligible {
+		if len(placed) >= p.MinClouds {
+			break
+		}
+		if !placed[name] {
+			placed[name] = true
+			reason("%s added to reach at least %d clouds", name, p.MinClouds)
+		}
+	}
+	if len(placed) < p.MinClouds {
+		return decision, fmt.Errorf("at least %d clouds required but only %d eligible", p.MinClouds, len(decision.Eligible))
+	}
+
+	for _, c := range clouds {
+		if placed[c.Name] {
+			decision.Targets = append(decision.Targets, c.Name)
+		}
+	}
+	if len(decision.Targets) == 0 {
+		reason("no clouds selected")
+	}
+	return decision, nil
+}
+
+// why the cloud is not eligible, empty if it is
+func exclusion(p Policy, c Cloud) string {
+	if p.Regions != nil && !contains(p.Regions, c.Region) {
+		return fmt.Sprintf("region %s not in %s", orUnknown(c.Region), allowed(p.Regions))
+	}
+	if p.Residency != nil && !contains(p.Residency, c.Residency) {
+		return fmt.Sprintf("residency %s not in %s", orUnknown(c.Residency), allowed(p.Residency))
+	}
+	return ""
+}
+
+// required clouds and the clouds supported through their cloud-env label
+func required(p Policy, clouds []Cloud) []string {
+	names := append([]string(nil), p.Required...)
+	for _, c := range clouds {
+		if contains(p.Labels, cloudEnvLabel+c.Name) {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+func known(clouds []Cloud, name string) bool {
+	for _, c := range clouds {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func orNil(list []string) []string {
+	if len(list) == 0 {
+		return nil
+	}
+	return list
+}
+
+func allowed(list []string) string {
+	if len(list) == 0 {
+		return "the common values of the cpols"
+	}
+	return strings.Join(list, ", ")
+}
+
+func orUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
+
+func contains(list []string, value string) bool {
+	for _, l := range list {
+		if l == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package policy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var testClouds = []Cloud{
+	{Name: "minikube", Region: "zurich", Residency: "ch"},
+	{Name: "bsc-aks", Region: "westeurope", Residency: "eu"},
+}
+
+func TestEvaluate_Labels(t *testing.T) {
+	decision, err := Evaluate(Policy{Labels: []string{"cloud-env-bsc-aks", "cloud-failover"}}, testClouds)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bsc-aks"}, decision.Targets)
+	assert.Equal(t, []string{"bsc-aks required"}, decision.Reasons)
+}
+
+func TestEvaluate_NoClouds(t *testing.T) {
+	decision, err := Evaluate(Policy{}, testClouds)
+	assert.NoError(t, err)
+	assert.Empty(t, decision.Targets)
+	assert.Equal(t, []string{"no clouds selected"}, decision.Reasons)
+}
+
+func TestEvaluate_PreferredWithinMax(t *testing.T) {
+	p := Policy{Required: []string{"bsc-aks"}, Preferred: []string{"minikube"}, MaxClouds: 1}
+
+	decision, err := Evaluate(p, testClouds)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bsc-aks"}, decision.Targets)
+	assert.Equal(t, []string{"bsc-aks required", "minikube preferred but at most 1 clouds allowed"}, decision.Reasons)
+}
+
+func TestEvaluate_TargetsInCloudOrder(t *testing.T) {
+	decision, err := Evaluate(Policy{Preferred: []string{"bsc-aks", "minikube"}}, testClouds)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"minikube", "bsc-aks"}, decision.Targets)
+}
+
+func TestEvaluate_MinClouds(t *testing.T) {
+	decision, err := Evaluate(Policy{Preferred: []string{"bsc-aks"}, MinClouds: 2}, testClouds)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"minikube", "bsc-aks"}, decision.Targets)
+	assert.Contains(t, decision.Reasons, "minikube added to reach at least 2 clouds")
+}
+
+func TestEvaluate_Residency(t *testing.T) {
+	decision, err := Evaluate(Policy{Preferred: []string{"bsc-aks"}, MinClouds: 1, Residency: []string{"ch"}}, testClouds)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"minikube"}, decision.Targets)
+	assert.Equal(t, []string{"minikube"}, decision.Eligible)
+	assert.Equal(t, []string{
+		"bsc-aks excluded, residency eu not in ch",
+		"bsc-aks preferred but excluded",
+		"minikube added to reach at least 1 clouds",
+	}, decision.Reasons)
+}
+
+func TestEvaluate_RequiredExcluded(t *testing.T) {
+	_, err := Evaluate(Policy{Required: []string{"bsc-aks"}, Regions: []string{"zurich"}}, testClouds)
+	assert.EqualError(t, err, "required cloud bsc-aks is excluded, region westeurope not in zurich")
+}
+
+func TestEvaluate_UnknownRegion(t *testing.T) {
+	clouds := []Cloud{{Name: "minikube"}}
+	_, err := Evaluate(Policy{MinClouds: 1, Regions: []string{"zurich"}}, clouds)
+	assert.EqualError(t, err, "at least 1 clouds required but only 0 eligible")
+}
+
+func TestEvaluate_TooManyRequired(t *testing.T) {
+	_, err := Evaluate(Policy{Required: []string{"minikube", "bsc-aks"}, MaxClouds: 1}, testClouds)
+	assert.EqualError(t, err, "2 clouds required but at most 1 allowed")
+}
+
+func TestMerge(t *testing.T) {
+	merged := Merge(
+		Policy{Labels: []string{"cloud-env-minikube"}, MaxClouds: 2, Residency: []string{"ch", "eu"}},
+		Policy{Preferred: []string{"bsc-aks"}, MinClouds: 1, MaxClouds: 1, Residency: []string{"eu"}},
+	)
+	assert.Equal(t, Policy{
+		Labels:    []string{"cloud-env-minikube"},
+		Preferred: []string{"bsc-aks"},
+		MinClouds: 1,
+		MaxClouds: 1,
+		Residency: []string{"eu"},
+	}, merged)
+}
+
+func TestMerge_DisjointRestrictions(t *testing.T) {
+	merged := Merge(Policy{Regions: []string{"zurich"}}, Policy{Regions: []string{"westeurope"}})
+	assert.NotNil(t, merged.Regions)
+	assert.Empty(t, merged.Regions)
+
+	decision, err := Evaluate(merged, testClouds)
+	assert.NoError(t, err)
+	assert.Empty(t, decision.Eligible)
+	assert.Equal(t, "minikube excluded, region zurich not in the common values of the cpols", decision.Reasons[0])
+}